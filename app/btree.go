@@ -0,0 +1,1078 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// HELPERS
+
+// B-tree page types, the first byte of the page header. Table B-trees store rows keyed by rowid with the data in the
+// leaves, index B-trees store key records that end with the rowid and keep entries in interior cells too.
+const (
+	pageTypeIndexInterior byte = 0x02
+	pageTypeTableInterior byte = 0x05
+	pageTypeIndexLeaf     byte = 0x0A
+	pageTypeTableLeaf     byte = 0x0D
+)
+
+func (db *Database) readBytesAtOffset(offset int64, numBytes int) ([]byte, error) {
+	return db.pager.readAt(offset, numBytes)
+}
+
+// pageOffsets returns where a page starts in the file and where its B-tree page header starts,
+// which is the same place except on page 1 where the 100-byte database header comes first
+func (db *Database) pageOffsets(pageNumber int32) (int64, int64) {
+	const headerSize int64 = 100
+	pageStart := int64(pageNumber-1) * int64(db.pageSize)
+	if pageNumber == 1 {
+		return pageStart, pageStart + headerSize
+	}
+	return pageStart, pageStart
+}
+
+// PageHeader is the header at the start of a B-tree page, parsed once when the page is read
+type PageHeader struct {
+	Offset              int32  // where the header starts in the page, 100 on page 1 and 0 on every other page
+	PageType            byte   // one of the pageType constants for a B-tree page
+	FirstFreeblock      uint16 // offset of the first block of free space in the page, 0 when there is none
+	CellCount           uint16
+	CellContentStart    int32 // where the cell content area starts, a stored 0 means 65536
+	FragmentedFreeBytes byte  // free bytes in fragments of 1 to 3 bytes, too small to be freeblocks
+	RightmostPointer    int32 // interior pages only, the child holding the keys larger than those of every cell
+}
+
+// isInterior reports whether the page is an interior page of a table or index B-tree
+func (h PageHeader) isInterior() bool {
+	return h.PageType == pageTypeTableInterior || h.PageType == pageTypeIndexInterior
+}
+
+// size is 12 bytes for interior pages as their header ends with the rightmost child pointer and 8 bytes for leaves
+func (h PageHeader) size() int32 {
+	if h.isInterior() {
+		return 12
+	}
+	return 8
+}
+
+// cellPointerOffset returns where entry i of the cell pointer array is in the page, the array follows the header
+func (h PageHeader) cellPointerOffset(i int32) int32 {
+	return h.Offset + h.size() + i*2
+}
+
+// readBTreePage returns the whole of a B-tree page in one read along with its parsed header, which starts at offset 0
+// except on page 1 where the 100-byte database header comes first. Offsets into the page are relative to its start.
+// Callers check the page type. A B-tree page whose cell pointer array doesn't fit on it is corrupt.
+func (db *Database) readBTreePage(pageNumber int32) ([]byte, PageHeader, error) {
+	pageStart, pageOffset := db.pageOffsets(pageNumber)
+	page, err := db.pager.readPage(int64(pageNumber))
+	if err != nil {
+		return nil, PageHeader{}, err
+	}
+	headerStart := int32(pageOffset - pageStart)
+	header := PageHeader{
+		Offset:              headerStart,
+		PageType:            page[headerStart],
+		FirstFreeblock:      binary.BigEndian.Uint16(page[headerStart+1:]),
+		CellCount:           binary.BigEndian.Uint16(page[headerStart+3:]),
+		CellContentStart:    int32(binary.BigEndian.Uint16(page[headerStart+5:])),
+		FragmentedFreeBytes: page[headerStart+7],
+	}
+	if header.CellContentStart == 0 {
+		header.CellContentStart = 65536
+	}
+	if header.isInterior() {
+		header.RightmostPointer = int32(binary.BigEndian.Uint32(page[headerStart+8:]))
+	}
+	switch header.PageType {
+	case pageTypeIndexInterior, pageTypeTableInterior, pageTypeIndexLeaf, pageTypeTableLeaf:
+		if header.cellPointerOffset(int32(header.CellCount)) > db.usableSize {
+			return nil, PageHeader{}, fmt.Errorf("page header of page %d claims %d cells", pageNumber, header.CellCount)
+		}
+	}
+	return page, header, nil
+}
+
+// getRightmostChildPageNumber returns the rightmost child of an interior page, checked like every child pointer
+func (db *Database) getRightmostChildPageNumber(header PageHeader) (int32, error) {
+	return header.RightmostPointer, db.checkPageNumber(header.RightmostPointer)
+}
+
+// getLeftChildPageNumber reads the 4-byte child page number that interior cells start with
+func (db *Database) getLeftChildPageNumber(page []byte, cellOffset int32) (int32, error) {
+	if int(cellOffset)+4 > len(page) {
+		return 0, fmt.Errorf("cell at offset %d runs past the end of its page", cellOffset)
+	}
+	pageNumber := int32(binary.BigEndian.Uint32(page[cellOffset:]))
+	return pageNumber, db.checkPageNumber(pageNumber)
+}
+
+// getCellContentOffset reads one entry of the cell pointer array, the offset of the cell relative to the start of
+// its page. It has to point inside the usable part of the page.
+func (db *Database) getCellContentOffset(page []byte, cellPointerOffset int32) (int32, error) {
+	if int(cellPointerOffset)+2 > len(page) {
+		return 0, fmt.Errorf("cell pointer at offset %d is past the end of its page", cellPointerOffset)
+	}
+	cellOffset := int32(binary.BigEndian.Uint16(page[cellPointerOffset:])) // offset in the cell array is relative to 0
+	if cellOffset == 0 || cellOffset >= db.usableSize {
+		return 0, fmt.Errorf("cell pointer at offset %d points outside its page: %d", cellPointerOffset, cellOffset)
+	}
+	return cellOffset, nil
+}
+
+// checkPageNumber returns an error unless pageNumber is a page of the file, child pointers are checked with it so a
+// corrupt one isn't followed. The lock-byte page never holds B-tree content so a pointer to it is corrupt as well.
+func (db *Database) checkPageNumber(pageNumber int32) error {
+	if pageNumber < 1 || uint32(pageNumber) > db.PageCount() {
+		return fmt.Errorf("page number %d is out of range", pageNumber)
+	}
+	if uint32(pageNumber) == db.lockBytePage() {
+		return fmt.Errorf("page number %d is the lock-byte page", pageNumber)
+	}
+	return nil
+}
+
+// readPayload reads a cell payload of payloadSize bytes starting at payloadOffset. When the payload is larger than
+// maxLocal only the first part is stored on the page, followed by a 4-byte page number of the first overflow page.
+// Each overflow page starts with the 4-byte number of the next overflow page (0 for the last) followed by content.
+func (db *Database) readPayload(payloadOffset int64, payloadSize int64, maxLocal int32) ([]byte, error) {
+	if payloadSize <= int64(maxLocal) {
+		return db.readBytesAtOffset(payloadOffset, int(payloadSize))
+	}
+
+	// Local payload threshold from the file format spec
+	usableSize := int64(db.usableSize)
+	minLocal := (usableSize-12)*32/255 - 23
+	localSize := minLocal + (payloadSize-minLocal)%(usableSize-4)
+	if localSize > int64(maxLocal) {
+		localSize = minLocal
+	}
+
+	payload, err := db.readBytesAtOffset(payloadOffset, int(localSize))
+	if err != nil {
+		return nil, err
+	}
+	data, err := db.readBytesAtOffset(payloadOffset+localSize, 4)
+	if err != nil {
+		return nil, err
+	}
+	overflowPageNumber := binary.BigEndian.Uint32(data)
+
+	// The chain is never longer than the pages the rest of the payload fills, so a corrupt chain that loops back on
+	// itself still ends
+	chainLength := (payloadSize - localSize + usableSize - 5) / (usableSize - 4)
+	for pages := int64(0); pages < chainLength && overflowPageNumber != 0; pages++ {
+		if overflowPageNumber > math.MaxInt32 {
+			return nil, fmt.Errorf("overflow page number %d is out of range", overflowPageNumber)
+		}
+		if err := db.checkPageNumber(int32(overflowPageNumber)); err != nil {
+			return nil, fmt.Errorf("overflow %v", err)
+		}
+		overflowPageOffset := int64(overflowPageNumber-1) * int64(db.pageSize)
+		data, err = db.readBytesAtOffset(overflowPageOffset, 4)
+		if err != nil {
+			return nil, err
+		}
+		nextPageNumber := binary.BigEndian.Uint32(data)
+
+		chunkSize := payloadSize - int64(len(payload))
+		if chunkSize > usableSize-4 {
+			chunkSize = usableSize - 4
+		}
+		chunk, err := db.readBytesAtOffset(overflowPageOffset+4, int(chunkSize))
+		if err != nil {
+			return nil, err
+		}
+		payload = append(payload, chunk...)
+		overflowPageNumber = nextPageNumber
+	}
+
+	if int64(len(payload)) != payloadSize {
+		return nil, fmt.Errorf("overflow chain ended after %d of %d payload bytes", len(payload), payloadSize)
+	}
+	return payload, nil
+}
+
+func (db *Database) processLeafCellRecord(cellContentOffset int64) ([]byte, []int64, int64, int64) {
+	// [varint] read size of the record
+	recordSize, bytesReadRecordSize := db.readVarintAt(cellContentOffset)
+	// [varint] read size of rowid
+	rowId, bytesReadRowId := db.readVarintAt(cellContentOffset + int64(bytesReadRecordSize))
+	if bytesReadRecordSize == 0 || bytesReadRowId == 0 || recordSize < 0 {
+		return nil, nil, 0, 0 // Malformed cell, callers see a record without columns
+	}
+
+	// Read the record data (with header), following the overflow chain if the record doesn't fit in the page
+	recordOffset := cellContentOffset + int64(bytesReadRecordSize) + int64(bytesReadRowId)
+	data, err := db.readPayload(recordOffset, recordSize, db.usableSize-35)
+	if err != nil {
+		return nil, nil, 0, 0
+	}
+
+	serialTypes, bodyOffset, err := parseRecordHeader(data)
+	if err != nil {
+		return nil, nil, 0, 0
+	}
+	return data, serialTypes, bodyOffset, rowId
+}
+
+// readVarintAt reads the varint at a file offset. A varint inside a cell never crosses the end of its page so at most
+// the rest of the page is read, bytesRead is 0 when the varint can't be read or is cut off
+func (db *Database) readVarintAt(offset int64) (int64, int32) {
+	numBytes := int64(9)
+	if pageEnd := (offset/int64(db.pageSize) + 1) * int64(db.pageSize); pageEnd-offset < numBytes {
+		numBytes = pageEnd - offset
+	}
+	data, err := db.readBytesAtOffset(offset, int(numBytes))
+	if err != nil {
+		return 0, 0
+	}
+	value, bytesRead := readVarint(data, 0)
+	if bytesRead > 0 && bytesRead < 9 && data[bytesRead-1]&0x80 != 0 {
+		return 0, 0 // Ran out of bytes while the continuation bit was still set
+	}
+	return value, bytesRead
+}
+
+// parseRecordHeader returns the serial types of a record and the offset its body starts at. It fails when the header
+// is malformed: its size or a serial type can't be read, the serial types don't end exactly at the header size, or the
+// columns would extend past the end of data
+func parseRecordHeader(data []byte) ([]int64, int64, error) {
+	// [varint] Parse record header
+	headerSize, bytesReadHeader := readVarint(data, 0)
+	if bytesReadHeader > 0 && bytesReadHeader < 9 && data[bytesReadHeader-1]&0x80 != 0 {
+		bytesReadHeader = 0 // Cut off by the end of the record
+	}
+	if bytesReadHeader == 0 || headerSize < int64(bytesReadHeader) || headerSize > int64(len(data)) {
+		return nil, 0, fmt.Errorf("invalid record header size %d for a %d byte record", headerSize, len(data))
+	}
+	headerOffset := int64(bytesReadHeader)
+	bodyOffset := headerSize // Body starts after the header
+	bodySize := int64(0)
+	// Parse serial types, every one takes at least a byte of the header
+	serialTypes := make([]int64, 0, headerSize-headerOffset)
+	for headerOffset < headerSize {
+		serialType, bytesRead := readVarint(data[:headerSize], int(headerOffset))
+		if bytesRead == 0 || serialType < 0 {
+			return nil, 0, fmt.Errorf("invalid serial type at record header offset %d", headerOffset)
+		}
+		if bytesRead < 9 && data[headerOffset+int64(bytesRead)-1]&0x80 != 0 {
+			// The last byte still has its continuation bit set, the varint runs past the header
+			return nil, 0, fmt.Errorf("serial type at record header offset %d crosses the header size %d", headerOffset, headerSize)
+		}
+		headerOffset += int64(bytesRead)
+		bodySize += int64(getSerialTypeSize(serialType))
+		serialTypes = append(serialTypes, serialType)
+	}
+	if headerOffset != headerSize {
+		return nil, 0, fmt.Errorf("record header consumed %d bytes but its size is %d", headerOffset, headerSize)
+	}
+	if bodyOffset+bodySize > int64(len(data)) {
+		return nil, 0, fmt.Errorf("record body needs %d bytes but only %d are left", bodySize, int64(len(data))-bodyOffset)
+	}
+	return serialTypes, bodyOffset, nil
+}
+
+// readRowValues decodes every column of a table leaf cell, padded with the column defaults when the record is short,
+// followed by the rowid. The INTEGER PRIMARY KEY column at layout.rowIdColIdx is stored as NULL so it's replaced by the
+// rowid, and integers in REAL columns are turned into floats. Cells of a WITHOUT ROWID table are index cells whose
+// values are put back in declared order, their rowid is NULL.
+func (db *Database) readRowValues(cellContentOffset int64, layout tableLayout) []Value {
+	var data []byte
+	var serialTypes []int64
+	var bodyOffset int64
+	var rowId Value
+	if layout.storedOrder != nil {
+		data, serialTypes, bodyOffset = db.processIndexRecord(cellContentOffset)
+	} else {
+		var id int64
+		data, serialTypes, bodyOffset, id = db.processLeafCellRecord(cellContentOffset)
+		rowId = Value{SerialType: 6, Data: id}
+	}
+	if serialTypes == nil {
+		return nil // Malformed cell, callers skip it
+	}
+	// Room for the defaults of columns the record doesn't store and the trailing rowid so the row is allocated once
+	rowValues := make([]Value, 0, max(len(serialTypes), len(layout.defaults))+1)
+	for _, serialType := range serialTypes {
+		size := getSerialTypeSize(serialType)
+		value := data[bodyOffset : bodyOffset+int64(size)]
+		rowValues = append(rowValues, db.decodeValue(serialType, value))
+		bodyOffset += int64(size)
+	}
+	if layout.storedOrder != nil {
+		// Primary key columns are stored first, reorder them into the declared positions
+		declared := make([]Value, len(layout.storedOrder))
+		for i, idx := range layout.storedOrder {
+			if i < len(rowValues) {
+				declared[idx] = rowValues[i]
+			} else {
+				declared[idx] = layout.defaults[idx]
+			}
+		}
+		rowValues = declared
+	}
+	// REAL columns store integral values as integers to save space, they still read back as floats
+	for idx := range rowValues {
+		if idx < len(layout.realColumns) && layout.realColumns[idx] {
+			if data, ok := rowValues[idx].Data.(int64); ok {
+				rowValues[idx] = Value{SerialType: 7, Data: float64(data)}
+			}
+		}
+	}
+	// Rows written before an ALTER TABLE ADD COLUMN don't store the new trailing columns, they read as their default
+	for len(rowValues) < len(layout.defaults) {
+		rowValues = append(rowValues, layout.defaults[len(rowValues)])
+	}
+	if layout.rowIdColIdx >= 0 && layout.rowIdColIdx < len(rowValues) {
+		rowValues[layout.rowIdColIdx] = rowId
+	}
+	// The rowid itself goes after the columns so SELECT rowid can refer to it
+	return append(rowValues, rowId)
+}
+
+func (db *Database) processIndexRecord(cellContentOffset int64) ([]byte, []int64, int64) {
+	// [varint] read size of the record
+	recordSize, bytesReadRecordSize := db.readVarintAt(cellContentOffset)
+	if bytesReadRecordSize == 0 || recordSize < 0 {
+		return nil, nil, 0
+	}
+	// Read the record data (with header), following the overflow chain if the record doesn't fit in the page
+	recordOffset := cellContentOffset + int64(bytesReadRecordSize)
+	data, err := db.readPayload(recordOffset, recordSize, (db.usableSize-12)*64/255-23)
+	if err != nil {
+		return nil, nil, 0
+	}
+
+	serialTypes, bodyOffset, err := parseRecordHeader(data)
+	if err != nil {
+		return nil, nil, 0
+	}
+	return data, serialTypes, bodyOffset
+}
+
+// indexRecordValues decodes every value of the index record at cellContentOffset, nil when the cell is malformed
+func (db *Database) indexRecordValues(cellContentOffset int64) []Value {
+	data, serialTypes, bodyOffset := db.processIndexRecord(cellContentOffset)
+	values := make([]Value, 0, len(serialTypes))
+	for _, serialType := range serialTypes {
+		size := getSerialTypeSize(serialType)
+		values = append(values, db.decodeValue(serialType, data[bodyOffset:bodyOffset+int64(size)]))
+		bodyOffset += int64(size)
+	}
+	return values
+}
+
+// PROCESS
+
+// forEachSchemaRow calls visit with every row of sqlite_schema, page 1 is the root of its table B-tree. The columns
+// are type, name, tbl_name, rootpage and sql, and returning false from visit stops the walk.
+func (db *Database) forEachSchemaRow(visit func(row []Value) bool) error {
+	_, err := db.scanTable(1, tableLayout{rowIdColIdx: -1}, func(rowValues []Value) bool {
+		if len(rowValues) < 5 {
+			return true // Not a schema row
+		}
+		return visit(rowValues)
+	})
+	return err
+}
+
+// getSchemaNames returns the name of every sqlite_schema row whose type column equals schemaType
+func (db *Database) getSchemaNames(schemaType string) ([]string, error) {
+	var names []string
+	err := db.forEachSchemaRow(func(row []Value) bool {
+		if name, ok := row[1].Data.(string); ok && row[0].String() == schemaType {
+			names = append(names, name)
+		}
+		return true
+	})
+	return names, err
+}
+
+// getSchemaStatements returns the sql column of every sqlite_schema row, only rows for tableName when it isn't empty.
+// Automatic indexes have a NULL sql value and are skipped like sqlite3 does.
+func (db *Database) getSchemaStatements(tableName string) ([]string, error) {
+	var statements []string
+	err := db.forEachSchemaRow(func(row []Value) bool {
+		if !row[4].IsNull() && (tableName == "" || row[2].String() == tableName) {
+			statements = append(statements, row[4].String())
+		}
+		return true
+	})
+	return statements, err
+}
+
+// schemaCreateStatement is how sqlite defines sqlite_schema itself, it has no row of its own
+const schemaCreateStatement = "CREATE TABLE sqlite_schema(type text, name text, tbl_name text, rootpage int, sql text)"
+
+// findTable returns the root page and CREATE statement of tableName from sqlite_schema, found is false when there is
+// no such table. Every lookup of a table by name goes through it. sqlite_schema and its older name sqlite_master are
+// the schema table on page 1.
+func (db *Database) findTable(tableName string) (int32, string, bool, error) {
+	if strings.EqualFold(tableName, "sqlite_schema") || strings.EqualFold(tableName, "sqlite_master") {
+		return 1, schemaCreateStatement, true, nil
+	}
+	var rootPage int32
+	var createStatement string
+	found := false
+	var rootPageErr error
+	err := db.forEachSchemaRow(func(row []Value) bool {
+		if row[0].String() == "table" && row[2].String() == tableName {
+			rootPage, rootPageErr = schemaRootPage(row)
+			createStatement, found = row[4].String(), true
+			return false
+		}
+		return true
+	})
+	if err == nil {
+		err = rootPageErr
+	}
+	return rootPage, createStatement, found, err
+}
+
+// schemaRootPage returns the rootpage column of a sqlite_schema row. Page numbers are stored as integers of any serial
+// type, one that isn't an integer or doesn't fit a page number is an error rather than being cut to another page.
+func schemaRootPage(row []Value) (int32, error) {
+	rootPage, ok := row[3].Data.(int64)
+	if !ok || rootPage < 1 || rootPage > math.MaxInt32 {
+		return 0, fmt.Errorf("invalid root page %s of %s", row[3].String(), row[1].String())
+	}
+	return int32(rootPage), nil
+}
+
+// findIndex returns the root page of an index on tableName whose first column is colName. Automatic indexes have no
+// CREATE statement, their columns would have to come from the table constraints so they aren't considered. Partial
+// indexes miss rows and DESC or COLLATE columns aren't in binary order, so only plain ascending indexes are used.
+func (db *Database) findIndex(tableName string, colName string) (int32, bool, error) {
+	var rootPage int32
+	found := false
+	var rootPageErr error
+	err := db.forEachSchemaRow(func(row []Value) bool {
+		if row[0].String() != "index" || row[2].String() != tableName || row[4].IsNull() || isPartialIndex(row[4].String()) {
+			return true
+		}
+		if indexColumns := parseColumnDefs(row[4].String()); len(indexColumns) > 0 && columnDefName(indexColumns[0]) == colName && isBinaryAscending(indexColumns[0]) {
+			rootPage, rootPageErr = schemaRootPage(row)
+			found = true
+			return false
+		}
+		return true
+	})
+	if err == nil {
+		err = rootPageErr
+	}
+	return rootPage, found, err
+}
+
+// isPartialIndex reports whether a CREATE INDEX statement has a WHERE clause
+func isPartialIndex(createStatement string) bool {
+	for _, token := range tokenizeSQL(stripSQLComments(createStatement)) {
+		if strings.EqualFold(token, "WHERE") {
+			return true
+		}
+	}
+	return false
+}
+
+// isBinaryAscending reports whether an indexed column or column definition sorts in ascending binary order, which is
+// the order a typed value comparison expects. DESC and any collation but BINARY order it differently.
+func isBinaryAscending(colDef string) bool {
+	tokens := tokenizeSQL(colDef)
+	for i := 1; i < len(tokens); i++ {
+		switch strings.ToUpper(tokens[i]) {
+		case "DESC":
+			return false
+		case "COLLATE":
+			if i+1 < len(tokens) && !strings.EqualFold(unquoteIdentifier(tokens[i+1]), "BINARY") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// getColumnDataHelper returns the projected values of every matching row in rowid order, after skipping the first
+// offset of them
+func (db *Database) getColumnDataHelper(pageNumber int32, colIdx []int, layout tableLayout, whereClause WhereClause, limit int, offset int) (Rows, error) {
+	var columnData Rows
+	if limit == 0 {
+		return columnData, nil
+	}
+	skipped := 0
+	_, err := db.scanTableRange(pageNumber, layout, whereRowIdRange(whereClause, layout), func(rowValues []Value) bool {
+		if matchesWhereClause(rowValues, whereClause) {
+			if skipped < offset {
+				skipped++
+				return true
+			}
+			if dataForCol := projectRow(rowValues, colIdx); len(dataForCol) != 0 {
+				columnData = append(columnData, dataForCol)
+			}
+		}
+		return limit == -1 || len(columnData) < limit // Stop reading cells once enough rows are collected
+	})
+	return columnData, err
+}
+
+// scanTable calls visit with the values of every row of the table B-tree rooted at pageNumber in rowid order, laid out
+// as readRowValues returns them. WITHOUT ROWID tables are read from their index B-tree in primary key order instead.
+// Nothing is collected, so it stops as soon as visit returns false and reports whether the scan reached the end. A
+// page or cell that can't be read ends the scan with an error.
+func (db *Database) scanTable(pageNumber int32, layout tableLayout, visit func(rowValues []Value) bool) (bool, error) {
+	return db.scanTableRange(pageNumber, layout, allRowIds, visit)
+}
+
+// scanTableRange is scanTable limited to the rows whose rowid is in rowIds. The key of an interior cell is the largest
+// rowid of its left child, so children that hold only rowids outside the range are never read. WITHOUT ROWID tables
+// have no rowids and are always read whole.
+func (db *Database) scanTableRange(pageNumber int32, layout tableLayout, rowIds rowIdRange, visit func(rowValues []Value) bool) (bool, error) {
+	pageStart, _ := db.pageOffsets(pageNumber)
+	page, header, err := db.readBTreePage(pageNumber)
+	if err != nil {
+		return false, err
+	}
+
+	switch header.PageType {
+	case pageTypeTableLeaf:
+		for i := int32(0); i < int32(header.CellCount); i++ {
+			cellPointerOffset := header.cellPointerOffset(i)
+			cellOffset, err := db.getCellContentOffset(page, cellPointerOffset)
+			if err != nil {
+				return false, err
+			}
+			cellContentOffset := pageStart + int64(cellOffset) // offsets in the cell pointer array are relative to the start of the page
+
+			rowValues := db.readRowValues(cellContentOffset, layout)
+			if rowValues == nil {
+				return false, fmt.Errorf("malformed cell %d on page %d", i, pageNumber)
+			}
+			if rowId, _ := rowValues[len(rowValues)-1].Data.(int64); !rowIds.contains(rowId) {
+				if rowId > rowIds.high {
+					break // Cells are in rowid order, the rest are past the range too
+				}
+				continue
+			}
+			if !visit(rowValues) {
+				return false, nil
+			}
+		}
+
+	case pageTypeTableInterior:
+		// The left child of cell i holds the rowids after the key of cell i-1 up to its own key
+		var previousKey int64
+		for i := int32(0); i < int32(header.CellCount); i++ {
+			if i > 0 && previousKey >= rowIds.high {
+				return true, nil // The rest of the children come after the range
+			}
+			cellPointerOffset := header.cellPointerOffset(i)
+			cellOffset, err := db.getCellContentOffset(page, cellPointerOffset)
+			if err != nil {
+				return false, err
+			}
+			key, bytesRead := readVarint(page, int(cellOffset)+4)
+			if bytesRead == 0 {
+				return false, fmt.Errorf("malformed cell %d on page %d", i, pageNumber)
+			}
+			previousKey = key
+			if key < rowIds.low {
+				continue // Every rowid of the child comes before the range
+			}
+			leftChildPageNumber, err := db.getLeftChildPageNumber(page, cellOffset)
+			if err != nil {
+				return false, err
+			}
+			if done, err := db.scanTableRange(leftChildPageNumber, layout, rowIds, visit); !done || err != nil {
+				return false, err
+			}
+		}
+		if header.CellCount > 0 && previousKey >= rowIds.high {
+			return true, nil
+		}
+
+		// Rightmost pointer
+		rightChildPageNumber, err := db.getRightmostChildPageNumber(header)
+		if err != nil {
+			return false, err
+		}
+		return db.scanTableRange(rightChildPageNumber, layout, rowIds, visit)
+
+	case pageTypeIndexLeaf, pageTypeIndexInterior:
+		// A WITHOUT ROWID table, ordered by primary key. Interior cells hold a row as well, it comes after the rows
+		// of their left child.
+		if layout.storedOrder == nil {
+			return false, fmt.Errorf("page %d of a rowid table is an index page", pageNumber)
+		}
+		for i := int32(0); i < int32(header.CellCount); i++ {
+			cellPointerOffset := header.cellPointerOffset(i)
+			cellOffset, err := db.getCellContentOffset(page, cellPointerOffset)
+			if err != nil {
+				return false, err
+			}
+			cellContentOffset := pageStart + int64(cellOffset) // offsets in the cell pointer array are relative to the start of the page
+			if header.PageType == pageTypeIndexInterior {
+				leftChildPageNumber, err := db.getLeftChildPageNumber(page, cellOffset)
+				if err != nil {
+					return false, err
+				}
+				if done, err := db.scanTableRange(leftChildPageNumber, layout, rowIds, visit); !done || err != nil {
+					return false, err
+				}
+				cellContentOffset += 4
+			}
+			rowValues := db.readRowValues(cellContentOffset, layout)
+			if rowValues == nil {
+				return false, fmt.Errorf("malformed cell %d on page %d", i, pageNumber)
+			}
+			if !visit(rowValues) {
+				return false, nil
+			}
+		}
+		if header.PageType == pageTypeIndexInterior {
+			rightChildPageNumber, err := db.getRightmostChildPageNumber(header)
+			if err != nil {
+				return false, err
+			}
+			return db.scanTableRange(rightChildPageNumber, layout, rowIds, visit)
+		}
+
+	default:
+		return false, fmt.Errorf("page %d has invalid page type %d", pageNumber, header.PageType)
+	}
+
+	return true, nil
+}
+
+// collectRowIds appends the rowid of every leaf cell of the table B-tree rooted at pageNumber to rowIds. Only the
+// varints at the start of each cell are read, the records themselves are never decoded.
+func (db *Database) collectRowIds(pageNumber int32, rowIds []int64) ([]int64, error) {
+	pageStart, _ := db.pageOffsets(pageNumber)
+	page, header, err := db.readBTreePage(pageNumber)
+	if err != nil {
+		return rowIds, err
+	}
+
+	switch header.PageType {
+	case pageTypeTableLeaf:
+		for i := int32(0); i < int32(header.CellCount); i++ {
+			cellPointerOffset := header.cellPointerOffset(i)
+			cellOffset, err := db.getCellContentOffset(page, cellPointerOffset)
+			if err != nil {
+				return rowIds, err
+			}
+			// The payload size comes before the rowid
+			cellContentOffset := pageStart + int64(cellOffset)
+			_, bytesReadRecordSize := db.readVarintAt(cellContentOffset)
+			rowId, bytesReadRowId := db.readVarintAt(cellContentOffset + int64(bytesReadRecordSize))
+			if bytesReadRecordSize == 0 || bytesReadRowId == 0 {
+				return rowIds, fmt.Errorf("malformed cell %d on page %d", i, pageNumber)
+			}
+			rowIds = append(rowIds, rowId)
+		}
+
+	case pageTypeTableInterior:
+		for i := int32(0); i < int32(header.CellCount); i++ {
+			cellPointerOffset := header.cellPointerOffset(i)
+			cellOffset, err := db.getCellContentOffset(page, cellPointerOffset)
+			if err != nil {
+				return rowIds, err
+			}
+			leftChildPageNumber, err := db.getLeftChildPageNumber(page, cellOffset)
+			if err != nil {
+				return rowIds, err
+			}
+			if rowIds, err = db.collectRowIds(leftChildPageNumber, rowIds); err != nil {
+				return rowIds, err
+			}
+		}
+
+		// Rightmost pointer
+		rightChildPageNumber, err := db.getRightmostChildPageNumber(header)
+		if err != nil {
+			return rowIds, err
+		}
+		return db.collectRowIds(rightChildPageNumber, rowIds)
+
+	default:
+		return rowIds, fmt.Errorf("page %d of a rowid table has page type %d", pageNumber, header.PageType)
+	}
+
+	return rowIds, nil
+}
+
+// readDataFromMultipleColumns returns the requested columns of the matching rows of tableName, the bool is false when
+// the table doesn't exist
+func (db *Database) readDataFromMultipleColumns(tableName string, colNames []string, whereClause WhereClause, orderBy OrderBy, limit int, offset int) (Rows, bool, error) {
+	rootPage, createStatement, found, err := db.findTable(tableName)
+	if !found || err != nil {
+		return nil, false, err
+	}
+	// Get order of columnName in table
+	columnDefs := parseColumnDefs(createStatement)
+	colIdxs := resolveColumnIndices(columnDefs, colNames)
+	resolvedClause := resolveWhereClause(columnDefs, whereClause)
+	layout := db.newTableLayout(createStatement)
+
+	// Task 9: Support ORDER BY, the sort key is fetched as an extra trailing column
+	orderColIdx := -1
+	if orderBy.Column != "" {
+		if orderColIdx = findColumnIndex(columnDefs, orderBy.Column); orderColIdx == -1 {
+			return nil, true, fmt.Errorf("no such column: %s", orderBy.Column)
+		}
+	}
+	if orderColIdx == -1 {
+		// With the columnName order and rootpage, we can use them to find the column data
+		columnData, err := db.getColumnDataHelper(rootPage, colIdxs, layout, resolvedClause, limit, offset)
+		return columnData, true, err
+	}
+
+	// Rows have to be sorted before the limit applies so the whole table is read
+	rows, err := db.getColumnDataHelper(rootPage, append(colIdxs, orderColIdx), layout, resolvedClause, -1, 0)
+	return sortRowsByTrailingKey(rows, orderBy.Descending, limit, offset), true, err
+}
+
+// countRecordsInBTree counts the rows of a table B-tree or the entries of an index B-tree
+func (db *Database) countRecordsInBTree(pageNumber int32) (int64, error) {
+	var numTables int64
+	page, header, err := db.readBTreePage(pageNumber)
+	if err != nil {
+		return 0, err
+	}
+
+	switch header.PageType {
+	case pageTypeTableLeaf, pageTypeIndexLeaf:
+		numTables += int64(header.CellCount)
+
+	case pageTypeTableInterior, pageTypeIndexInterior:
+		if header.PageType == pageTypeIndexInterior {
+			numTables += int64(header.CellCount) // Unlike table interior cells, every index interior cell is an entry itself
+		}
+
+		for i := int32(0); i < int32(header.CellCount); i++ {
+			cellPointerOffset := header.cellPointerOffset(i)
+			cellOffset, err := db.getCellContentOffset(page, cellPointerOffset)
+			if err != nil {
+				return 0, err
+			}
+			leftChildPageNumber, err := db.getLeftChildPageNumber(page, cellOffset)
+			if err != nil {
+				return 0, err
+			}
+			tempCount, err := db.countRecordsInBTree(leftChildPageNumber)
+			if err != nil {
+				return 0, err
+			}
+			numTables += tempCount
+		}
+
+		// Rightmost pointer
+		rightChildPageNumber, err := db.getRightmostChildPageNumber(header)
+		if err != nil {
+			return 0, err
+		}
+		tempCount, err := db.countRecordsInBTree(rightChildPageNumber)
+		if err != nil {
+			return 0, err
+		}
+		numTables += tempCount
+
+	default:
+		return 0, fmt.Errorf("page %d has invalid page type %d", pageNumber, header.PageType)
+	}
+
+	return numTables, nil
+}
+
+// countMatchingRecordsInBTree counts the rows of a table B-tree that satisfy the where clause
+func (db *Database) countMatchingRecordsInBTree(pageNumber int32, layout tableLayout, whereClause WhereClause) (int64, error) {
+	var count int64
+	_, err := db.scanTableRange(pageNumber, layout, whereRowIdRange(whereClause, layout), func(rowValues []Value) bool {
+		if matchesWhereClause(rowValues, whereClause) {
+			count++
+		}
+		return true
+	})
+	return count, err
+}
+
+func (db *Database) getRowIdsFromIndexTreeHelper(pageNumber int32, key Value) ([]string, error) {
+	var rowIds []string
+	pageStart, _ := db.pageOffsets(pageNumber)
+	page, header, err := db.readBTreePage(pageNumber)
+	if err != nil {
+		return rowIds, err
+	}
+
+	switch header.PageType {
+	case pageTypeIndexLeaf:
+		// loop through cell count
+		for i := int32(0); i < int32(header.CellCount); i++ {
+			cellPointerOffset := header.cellPointerOffset(i)
+			cellOffset, err := db.getCellContentOffset(page, cellPointerOffset)
+			if err != nil {
+				return rowIds, err
+			}
+			cellContentOffset := pageStart + int64(cellOffset) // offsets in the cell pointer array are relative to the start of the page
+			recordValues := db.indexRecordValues(cellContentOffset)
+			if len(recordValues) >= 2 && compareTypedValues(recordValues[0], key) == 0 {
+				rowIds = append(rowIds, recordValues[len(recordValues)-1].String()) // rowid is the last value of an index record
+			}
+		}
+
+		return rowIds, nil
+
+	case pageTypeIndexInterior:
+		for i := int32(0); i < int32(header.CellCount); i++ {
+			cellPointerOffset := header.cellPointerOffset(i)
+			cellOffset, err := db.getCellContentOffset(page, cellPointerOffset)
+			if err != nil {
+				return rowIds, err
+			}
+			cellContentOffset := pageStart + int64(cellOffset) // offsets in the cell pointer array are relative to the start of the page
+			leftChildPageNumber, err := db.getLeftChildPageNumber(page, cellOffset)
+			if err != nil {
+				return rowIds, err
+			}
+			// The record follows the 4-byte left child pointer
+			recordValues := db.indexRecordValues(cellContentOffset + 4)
+			if len(recordValues) < 2 {
+				continue
+			}
+			cmp := compareTypedValues(key, recordValues[0])
+			if cmp < 0 {
+				tempData, err := db.getRowIdsFromIndexTreeHelper(leftChildPageNumber, key)
+				return append(rowIds, tempData...), err
+			} else if cmp == 0 {
+				// Equal entries in the left child sort before this cell's own entry, keep rowids in index order
+				tempData, err := db.getRowIdsFromIndexTreeHelper(leftChildPageNumber, key)
+				rowIds = append(rowIds, tempData...)
+				if err != nil {
+					return rowIds, err
+				}
+				rowIds = append(rowIds, recordValues[len(recordValues)-1].String()) // stores payload too, seems like not in leaf nodes
+			}
+		}
+
+		// Rightmost pointer
+		rightChildPageNumber, err := db.getRightmostChildPageNumber(header)
+		if err != nil {
+			return rowIds, err
+		}
+		tempData, err := db.getRowIdsFromIndexTreeHelper(rightChildPageNumber, key)
+		return append(rowIds, tempData...), err
+	}
+
+	return rowIds, fmt.Errorf("index page %d has invalid page type %d", pageNumber, header.PageType)
+}
+
+// getRowIdsFromIndexTree finds an index on tableName whose first column is colName and returns the rowids of the entries
+// equal to key, the bool is false when no such index exists. Keys are compared by storage class first like sqlite
+// orders them, so key has to be typed the way the column's affinity would store it.
+func (db *Database) getRowIdsFromIndexTree(tableName string, colName string, key Value) ([]string, bool, error) {
+	rootPage, found, err := db.findIndex(tableName, colName)
+	if !found || err != nil {
+		return nil, false, err
+	}
+
+	// With the rootPage of the index tree find the row ids, the rows themselves are read by readDataByRowIds
+	rowIds, err := db.getRowIdsFromIndexTreeHelper(rootPage, key)
+	return rowIds, true, err
+}
+
+// findRowByRowId descends a table B-tree from rootPage using the rowid keys of the interior cells and binary searches
+// each page, so a point lookup reads O(depth) pages. It returns the content offset of the leaf cell holding rowId.
+func (db *Database) findRowByRowId(rootPage int32, rowId int64) (int64, bool, error) {
+	pageNumber := rootPage
+	for {
+		pageStart, _ := db.pageOffsets(pageNumber)
+		page, header, err := db.readBTreePage(pageNumber)
+		if err != nil {
+			return 0, false, err
+		}
+		if header.PageType != pageTypeTableLeaf && header.PageType != pageTypeTableInterior {
+			return 0, false, fmt.Errorf("table page %d has invalid page type %d", pageNumber, header.PageType)
+		}
+
+		// Leaf cells start with the payload size varint before the rowid, interior cells with the 4-byte left child
+		// pointer. The first cell pointer that can't be read is kept in cellErr and ends the search.
+		var cellErr error
+		cellOffset := func(i int32) int32 {
+			cellOffset, err := db.getCellContentOffset(page, header.cellPointerOffset(i))
+			if err != nil && cellErr == nil {
+				cellErr = err
+			}
+			return cellOffset
+		}
+		cellKey := func(cellOffset int32) int64 {
+			cellContentOffset := pageStart + int64(cellOffset) // offsets in the cell pointer array are relative to the start of the page
+			if header.PageType == pageTypeTableInterior {
+				key, _ := db.readVarintAt(cellContentOffset + 4)
+				return key
+			}
+			_, bytesReadRecordSize := db.readVarintAt(cellContentOffset)
+			key, _ := db.readVarintAt(cellContentOffset + int64(bytesReadRecordSize))
+			return key
+		}
+
+		// Binary search for the first cell whose key is >= rowId
+		cellCount := int32(header.CellCount)
+		low, high := int32(0), cellCount
+		for low < high {
+			mid := (low + high) / 2
+			if cellKey(cellOffset(mid)) < rowId {
+				low = mid + 1
+			} else {
+				high = mid
+			}
+		}
+		if cellErr != nil {
+			return 0, false, cellErr
+		}
+
+		if header.PageType == pageTypeTableLeaf {
+			if low < cellCount && cellKey(cellOffset(low)) == rowId {
+				return pageStart + int64(cellOffset(low)), cellErr == nil, cellErr
+			}
+			return 0, false, nil
+		}
+
+		// Interior page, keys are the largest rowid in the left subtree
+		if low == cellCount {
+			pageNumber, err = db.getRightmostChildPageNumber(header)
+			if err != nil {
+				return 0, false, err
+			}
+			continue
+		}
+		pageNumber, err = db.getLeftChildPageNumber(page, cellOffset(low))
+		if err != nil {
+			return 0, false, err
+		}
+		if cellErr != nil {
+			return 0, false, cellErr
+		}
+	}
+}
+
+func (db *Database) readDataByRowIdsHelper(pageNumber int32, colIdx []int, layout tableLayout, rowIdTarget string) (Rows, error) {
+	var columnData Rows
+	rowIdIntTarget, err := strconv.ParseInt(rowIdTarget, 10, 64)
+	if err != nil {
+		return columnData, fmt.Errorf("invalid rowid in index: %s", rowIdTarget)
+	}
+
+	cellContentOffset, found, err := db.findRowByRowId(pageNumber, rowIdIntTarget)
+	if !found || err != nil {
+		return columnData, err
+	}
+
+	rowValues := db.readRowValues(cellContentOffset, layout)
+	if rowValues == nil {
+		return columnData, fmt.Errorf("malformed cell for rowid %d", rowIdIntTarget)
+	}
+	columnData = append(columnData, projectRow(rowValues, colIdx))
+	return columnData, nil // rowid is unique so there is at most one row
+}
+
+func (db *Database) readDataByRowIds(tableName string, colNames []string, rowIds []string) (Rows, error) {
+	var columnData Rows
+	rootPage, createStatement, found, err := db.findTable(tableName)
+	if !found || err != nil {
+		return columnData, err
+	}
+	// Get order of columnName in table
+	columnDefs := parseColumnDefs(createStatement)
+	colIdxs := resolveColumnIndices(columnDefs, colNames)
+	layout := db.newTableLayout(createStatement)
+
+	// With the columnName order and rootpage, we can use them to find the column data
+	for _, rowId := range rowIds {
+		tempData, err := db.readDataByRowIdsHelper(rootPage, colIdxs, layout, rowId)
+		columnData = append(columnData, tempData...)
+		if err != nil {
+			return columnData, err
+		}
+	}
+	return columnData, nil
+}
+
+// CellColumn is one value of a record as stored: its serial type, the number of body bytes and the decoded value
+type CellColumn struct {
+	SerialType int64
+	Size       int
+	Value      Value
+}
+
+// CellInfo is the parsed content of one cell, for inspecting the file format with .cell
+type CellInfo struct {
+	PageType      byte
+	Offset        int64 // file offset of the cell
+	LeftChildPage int32 // interior cells only
+	RowId         int64 // table cells only, the key of a table interior cell
+	HeaderSize    int64 // 0 when the cell has no record, like a table interior cell
+	Columns       []CellColumn
+}
+
+// Cell parses cell index of a page the same way queries read it
+func (db *Database) Cell(pageNumber int32, index int) (CellInfo, error) {
+	if err := db.checkPageNumber(pageNumber); err != nil {
+		return CellInfo{}, err
+	}
+	pageStart, _ := db.pageOffsets(pageNumber)
+	page, header, err := db.readBTreePage(pageNumber)
+	if err != nil {
+		return CellInfo{}, err
+	}
+	switch header.PageType {
+	case pageTypeIndexInterior, pageTypeTableInterior, pageTypeIndexLeaf, pageTypeTableLeaf:
+	default:
+		return CellInfo{}, fmt.Errorf("page %d is not a B-tree page (type %d)", pageNumber, header.PageType)
+	}
+	if index < 0 || index >= int(header.CellCount) {
+		return CellInfo{}, fmt.Errorf("page %d has %d cells", pageNumber, header.CellCount)
+	}
+
+	cellPointerOffset := header.cellPointerOffset(int32(index))
+	cellOffset, err := db.getCellContentOffset(page, cellPointerOffset)
+	if err != nil {
+		return CellInfo{}, err
+	}
+	cellContentOffset := pageStart + int64(cellOffset) // offsets in the cell pointer array are relative to the start of the page
+	cell := CellInfo{PageType: header.PageType, Offset: cellContentOffset}
+
+	var data []byte
+	var serialTypes []int64
+	var bodyOffset int64
+	switch header.PageType {
+	case pageTypeTableLeaf:
+		data, serialTypes, bodyOffset, cell.RowId = db.processLeafCellRecord(cellContentOffset)
+	case pageTypeTableInterior:
+		// [4 bytes] left child page number, [varint] largest rowid in it
+		if cell.LeftChildPage, err = db.getLeftChildPageNumber(page, cellOffset); err != nil {
+			return cell, err
+		}
+		cell.RowId, _ = db.readVarintAt(cellContentOffset + 4)
+		return cell, nil
+	case pageTypeIndexInterior:
+		if cell.LeftChildPage, err = db.getLeftChildPageNumber(page, cellOffset); err != nil {
+			return cell, err
+		}
+		data, serialTypes, bodyOffset = db.processIndexRecord(cellContentOffset + 4)
+	case pageTypeIndexLeaf:
+		data, serialTypes, bodyOffset = db.processIndexRecord(cellContentOffset)
+	}
+	if serialTypes == nil {
+		return cell, fmt.Errorf("cell %d of page %d has a malformed record", index, pageNumber)
+	}
+
+	cell.HeaderSize = bodyOffset
+	for _, serialType := range serialTypes {
+		size := getSerialTypeSize(serialType)
+		value := data[bodyOffset : bodyOffset+int64(size)]
+		cell.Columns = append(cell.Columns, CellColumn{SerialType: serialType, Size: size, Value: db.decodeValue(serialType, value)})
+		bodyOffset += int64(size)
+	}
+	return cell, nil
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRecordHeaderRejectsMalformedHeaders(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty record", []byte{}},
+		{"header size of 0", []byte{0x00, 0x01}},
+		{"header size past the end of the record", []byte{0x7f, 0x01, 0x01}},
+		{"header size varint cut off", []byte{0x81}},
+		{"serial type crossing the header size", []byte{0x02, 0x81, 0x01, 0x01}},
+		{"body shorter than the serial types", []byte{0x03, 0x01, 0x06, 0x05}},
+		{"text longer than the record", []byte{0x02, 0x21, 'a', 'b'}},
+		{"negative serial type", []byte{0x0a, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if serialTypes, _, err := parseRecordHeader(tt.data); err == nil {
+				t.Errorf("parseRecordHeader(%x) = %v, want an error", tt.data, serialTypes)
+			}
+		})
+	}
+
+	serialTypes, bodyOffset, err := parseRecordHeader(testRecord(nil, 5, "ab"))
+	if err != nil || !reflect.DeepEqual(serialTypes, []int64{0, 1, 17}) || bodyOffset != 4 {
+		t.Errorf("parseRecordHeader of a valid record = %v, %d, %v", serialTypes, bodyOffset, err)
+	}
+}
+
+// patchFile overwrites bytes of a database file written by testDB
+func patchFile(t *testing.T, path string, offset int64, data []byte) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteAt(data, offset); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCorruptPagesReturnErrors(t *testing.T) {
+	newFile := func() (string, int64) {
+		b := newTestDB(t, 4096)
+		rootPage := b.addTable("t", "CREATE TABLE t(id integer primary key, v text)",
+			testRow{1, []any{nil, "one"}}, testRow{2, []any{nil, "two"}}, testRow{3, []any{nil, "three"}})
+		return b.path(), int64(rootPage-1) * 4096
+	}
+
+	t.Run("record header size past the end of the record", func(t *testing.T) {
+		path, pageStart := newFile()
+		// The second cell pointer follows the 8-byte leaf header, the cell is [size][rowid][record]
+		file, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cellOffset := pageStart + int64(binary.BigEndian.Uint16(file[pageStart+10:]))
+		patchFile(t, path, cellOffset+2, []byte{0x7f})
+		db := openTestDB(t, path)
+
+		if _, err := db.Cell(2, 1); err == nil {
+			t.Error("Cell of the corrupt record succeeded")
+		}
+		if _, err := db.Query("t", []string{"id", "v"}, nil, OrderBy{}, -1, 0); err == nil {
+			t.Error("scan over the corrupt record succeeded")
+		}
+		if cell, err := db.Cell(2, 2); err != nil || cell.RowId != 3 {
+			t.Errorf("Cell of the next record = %+v, %v", cell, err)
+		}
+	})
+
+	t.Run("cell count past the end of the page", func(t *testing.T) {
+		path, pageStart := newFile()
+		patchFile(t, path, pageStart+3, []byte{0xff, 0xff})
+		db := openTestDB(t, path)
+
+		if _, err := db.Cell(2, 0); err == nil {
+			t.Error("Cell on a page claiming 65535 cells succeeded")
+		}
+		if _, err := db.Count("t", nil); err == nil {
+			t.Error("Count over a page claiming 65535 cells succeeded")
+		}
+	})
+
+	t.Run("cell pointer outside the page", func(t *testing.T) {
+		path, pageStart := newFile()
+		patchFile(t, path, pageStart+8, []byte{0xff, 0xff})
+		db := openTestDB(t, path)
+
+		if _, err := db.Cell(2, 0); err == nil {
+			t.Error("Cell with a pointer past the page succeeded")
+		}
+		if _, err := db.Query("t", []string{"v"}, nil, OrderBy{}, -1, 0); err == nil {
+			t.Error("scan over a pointer past the page succeeded")
+		}
+	})
+}
+
+func TestCorruptOverflowChainsReturnErrors(t *testing.T) {
+	// A record of 2000 bytes on 512-byte pages keeps 476 bytes on its leaf and needs three overflow pages. Pages of
+	// 512 bytes put the lock-byte page 1GB into the file at page 2097153.
+	const lockBytePage = 1<<30/512 + 1
+	record := testRecord(nil, strings.Repeat("x", 1995))
+	newDB := func(overflowPages ...uint32) *Database {
+		b := newTestDB(t, 512)
+		usable := b.pageSize
+		minLocal := (usable-12)*32/255 - 23
+		localSize := minLocal + (len(record)-minLocal)%(usable-4)
+		if localSize > usable-35 {
+			localSize = minLocal
+		}
+		leaf := b.allocPage()
+		cell := append(testVarint(int64(len(record))), testVarint(1)...)
+		cell = append(cell, record[:localSize]...)
+		cell = binary.BigEndian.AppendUint32(cell, overflowPages[0])
+		b.writePage(leaf, pageTypeTableLeaf, [][]byte{cell}, 0)
+		b.schema = append(b.schema, []any{"table", "t", "t", leaf, "CREATE TABLE t(id integer primary key, v text)"})
+		for i := 0; i < 3; i++ {
+			page := b.allocPage()
+			if i+1 < len(overflowPages) {
+				binary.BigEndian.PutUint32(b.pages[page], overflowPages[i+1])
+			}
+		}
+		if slices.Contains(overflowPages, lockBytePage) {
+			b.reservePage(lockBytePage + 1) // The file has to reach past the lock-byte page for it to be in range
+		}
+		return b.open()
+	}
+
+	// The leaf is page 2 and the overflow pages 3 to 5
+	if rows, err := newDB(3, 4, 5, 0).Query("t", []string{"v"}, nil, OrderBy{}, -1, 0); err != nil || len(rows) != 1 {
+		t.Fatalf("reading an intact chain returned %d rows, %v", len(rows), err)
+	}
+	tests := []struct {
+		name  string
+		chain []uint32
+	}{
+		{"first page past the end of the file", []uint32{99}},
+		{"later page past the end of the file", []uint32{3, 4, 99}},
+		{"page number past 2^31", []uint32{3, 0xffffffff}},
+		{"page 0 before the payload is complete", []uint32{3, 4, 0}},
+		{"lock-byte page", []uint32{3, 4, lockBytePage}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newDB(tt.chain...).Query("t", []string{"v"}, nil, OrderBy{}, -1, 0); err == nil {
+				t.Error("reading the record succeeded")
+			}
+		})
+	}
+
+	// A chain that points back at itself stops once the payload is read instead of looping
+	done := make(chan struct{})
+	go func() {
+		newDB(3, 3, 3, 3).Query("t", []string{"v"}, nil, OrderBy{}, -1, 0)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reading a chain that loops back on itself didn't finish")
+	}
+}
+
+func TestCellsPast2GBOffset(t *testing.T) {
+	// With 64K pages, page 40000 starts 2.6GB into the file and page 70000 past 4GB where uint32 offsets wrap
+	const leafPage, bigPage, overflowPage = 40000, 70000, 70001
+	b := newTestDB(t, 65536)
+	b.addTableAt(leafPage, "t", "CREATE TABLE t(id integer primary key, v text)",
+		testRow{1, []any{nil, "first"}}, testRow{2, []any{nil, "second"}})
+
+	// A row whose record doesn't fit in its leaf spills into an overflow page past 4GB
+	record := testRecord(nil, strings.Repeat("x", 99995))
+	usable := b.pageSize
+	minLocal := (usable-12)*32/255 - 23
+	localSize := minLocal + (len(record)-minLocal)%(usable-4)
+	if localSize > usable-35 {
+		localSize = minLocal
+	}
+	cell := append(testVarint(int64(len(record))), testVarint(1)...)
+	cell = append(cell, record[:localSize]...)
+	cell = binary.BigEndian.AppendUint32(cell, overflowPage)
+	b.reservePage(bigPage)
+	b.writePage(bigPage, pageTypeTableLeaf, [][]byte{cell}, 0)
+	b.schema = append(b.schema, []any{"table", "big", "big", bigPage, "CREATE TABLE big(id integer primary key, v text)"})
+	b.reservePage(overflowPage)
+	copy(b.pages[overflowPage][4:], record[localSize:]) // The next overflow page is 0, the chain ends here
+	db := b.open()
+
+	cellInfo, err := db.Cell(leafPage, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cellInfo.Offset <= 1<<31 || cellInfo.RowId != 2 || len(cellInfo.Columns) != 2 || cellInfo.Columns[1].Value.String() != "second" {
+		t.Errorf("Cell(%d, 1) = %+v", leafPage, cellInfo)
+	}
+	got := queryStrings(t, db, "t", []string{"id", "v"}, nil)
+	if want := [][]string{{"1", "first"}, {"2", "second"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SELECT id, v FROM t returned %v, want %v", got, want)
+	}
+
+	rows, err := db.Query("big", []string{"v"}, nil, OrderBy{}, -1, 0)
+	if err != nil || len(rows) != 1 || rows[0][0].String() != strings.Repeat("x", 99995) {
+		t.Fatalf("SELECT v FROM big returned %d rows, %v", len(rows), err)
+	}
+	if problems, err := db.IntegrityCheck(); err != nil || len(problems) != 0 {
+		t.Errorf("IntegrityCheck() = %v, %v", problems, err)
+	}
+}
+
+func TestIndexLookupComparesTypedKeys(t *testing.T) {
+	// A TEXT index of "1" to "20000" sorts "10000" before "5", a numeric comparison would descend the wrong way
+	b := newTestDB(t, 512)
+	var rows []testRow
+	var keys [][]any
+	for i := 1; i <= 20000; i++ {
+		rows = append(rows, testRow{rowId: int64(i), values: []any{nil, fmt.Sprint(i)}})
+		keys = append(keys, []any{fmt.Sprint(i), i})
+	}
+	slices.SortFunc(keys, func(a, b []any) int { return strings.Compare(a[0].(string), b[0].(string)) })
+	b.addTable("t", "CREATE TABLE t(id integer primary key, s text)", rows...)
+	b.addIndex("index", "t_s", "t", "CREATE INDEX t_s ON t(s)", keys...)
+	db := b.open()
+
+	for _, key := range []Value{{SerialType: 15, Data: "5"}, {SerialType: 23, Data: "19999"}, {SerialType: 15, Data: "1"}} {
+		rowIds, found, err := db.getRowIdsFromIndexTree("t", "s", key)
+		if err != nil || !found || !slices.Equal(rowIds, []string{key.Data.(string)}) {
+			t.Errorf("index lookup of %q = %v, %v, %v", key.Data, rowIds, found, err)
+		}
+	}
+	// The integer 5 is a number and sorts before every text key
+	if rowIds, _, err := db.getRowIdsFromIndexTree("t", "s", Value{SerialType: 1, Data: int64(5)}); err != nil || len(rowIds) != 0 {
+		t.Errorf("index lookup of the integer 5 = %v, %v, want no rows", rowIds, err)
+	}
+}
+
+func TestIndexWithInteriorPages(t *testing.T) {
+	// Every key has 7 rows so runs of equal keys cross leaf boundaries and the dividers in the interior pages
+	b := newTestDB(t, 512)
+	var rows []testRow
+	var keys [][]any
+	for i := 1; i <= 5000; i++ {
+		rows = append(rows, testRow{rowId: int64(i), values: []any{nil, i / 7}})
+		keys = append(keys, []any{i / 7, i})
+	}
+	b.addTable("t", "CREATE TABLE t(id integer primary key, n integer)", rows...)
+	rootPage := b.addIndex("index", "t_n", "t", "CREATE INDEX t_n ON t(n)", keys...)
+	db := b.open()
+
+	_, header, err := db.readBTreePage(int32(rootPage))
+	if err != nil || header.PageType != pageTypeIndexInterior {
+		t.Fatalf("index root page has type %d, %v, want an interior page", header.PageType, err)
+	}
+	if _, childHeader, err := db.readBTreePage(header.RightmostPointer); err != nil || childHeader.PageType != pageTypeIndexInterior {
+		t.Fatalf("rightmost child of the index root has type %d, %v, want a second interior level", childHeader.PageType, err)
+	}
+
+	if count, err := db.countRecordsInBTree(int32(rootPage)); err != nil || count != 5000 {
+		t.Errorf("countRecordsInBTree(index) = %d, %v, want 5000", count, err)
+	}
+	for n := 0; n <= 5000/7; n++ {
+		var want []string
+		for i := max(n*7, 1); i < n*7+7 && i <= 5000; i++ {
+			want = append(want, fmt.Sprint(i))
+		}
+		rowIds, found, err := db.getRowIdsFromIndexTree("t", "n", Value{SerialType: 1, Data: int64(n)})
+		if err != nil || !found || !slices.Equal(rowIds, want) {
+			t.Fatalf("index lookup of %d = %v, %v, %v, want %v", n, rowIds, found, err, want)
+		}
+	}
+	if got := queryStrings(t, db, "t", []string{"id"}, mustParseWhere(t, "n = 300")); !reflect.DeepEqual(got, [][]string{{"2100"}, {"2101"}, {"2102"}, {"2103"}, {"2104"}, {"2105"}, {"2106"}}) {
+		t.Errorf("WHERE n = 300 returned %v", got)
+	}
+	if count, err := db.Count("t", mustParseWhere(t, "n = 714")); err != nil || count != 3 {
+		t.Errorf("COUNT(*) WHERE n = 714 = %d, %v, want 3", count, err)
+	}
+}
+
+func TestFindIndexSkipsIndexesInAnotherOrder(t *testing.T) {
+	b := newTestDB(t, 4096)
+	rows := []testRow{{1, []any{nil, "K1", 1}}, {2, []any{nil, "k2", 1}}, {3, []any{nil, "K3", 0}}}
+	b.addTable("t", "CREATE TABLE t(id integer primary key, w text, flag int)", rows...)
+	b.addIndex("index", "w_desc", "t", "CREATE INDEX w_desc ON t(w DESC)", []any{"k2", 2}, []any{"K3", 3}, []any{"K1", 1})
+	b.addIndex("index", "w_nocase", "t", "CREATE INDEX w_nocase ON t(w COLLATE NOCASE, flag)",
+		[]any{"K1", 1, 1}, []any{"k2", 1, 2}, []any{"K3", 0, 3})
+	b.addIndex("index", "flag_set", "t", "CREATE INDEX flag_set ON t(flag) WHERE flag = 1", []any{1, 1}, []any{1, 2})
+	b.addIndex("index", "flag_binary", "t", "CREATE INDEX flag_binary ON t(flag COLLATE BINARY ASC)", []any{0, 3}, []any{1, 1}, []any{1, 2})
+	db := b.open()
+
+	if _, found, err := db.findIndex("t", "w"); err != nil || found {
+		t.Errorf("findIndex(w) found a DESC or NOCASE index, err %v", err)
+	}
+	rootPage, found, err := db.findIndex("t", "flag")
+	if err != nil || !found || rootPage != 6 {
+		t.Errorf("findIndex(flag) = %d, %v, %v, want the plain index on page 6", rootPage, found, err)
+	}
+	tests := []struct {
+		where string
+		want  [][]string
+	}{
+		{"w = 'K3'", [][]string{{"3"}}},
+		{"w = 'K1'", [][]string{{"1"}}},
+		{"flag = 1", [][]string{{"1"}, {"2"}}},
+		{"flag = 0", [][]string{{"3"}}},
+	}
+	for _, tt := range tests {
+		if got := queryStrings(t, db, "t", []string{"id"}, mustParseWhere(t, tt.where)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("WHERE %s returned %v, want %v", tt.where, got, tt.want)
+		}
+	}
+}
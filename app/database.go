@@ -0,0 +1,495 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Database is an open SQLite file. Every read goes through its pager, so the traversal methods only need page numbers.
+type Database struct {
+	file         *os.File
+	header       []byte // the 100-byte database header at the start of page 1
+	pageSize     int32
+	usableSize   int32 // page size minus the reserved space extensions keep at the end of every page
+	textEncoding uint32
+	pager        *Pager
+}
+
+// OpenDatabase opens the file at path and reads the settings the traversal needs from the database header
+func OpenDatabase(path string) (*Database, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 100)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		file.Close()
+		if err == io.EOF {
+			return nil, fmt.Errorf("not a database file: %s", path) // Too short to hold a header
+		}
+		return nil, fmt.Errorf("error reading database header: %v", err)
+	}
+	// Every database starts with the 16-byte magic string, anything else is some other kind of file
+	if string(header[:16]) != "SQLite format 3\x00" {
+		file.Close()
+		return nil, fmt.Errorf("not a database file: %s", path)
+	}
+
+	// The page size is a power of two between 512 and 65536, the largest doesn't fit in 2 bytes so it is stored as 1
+	pageSize := int32(binary.BigEndian.Uint16(header[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	db := &Database{
+		file:         file,
+		header:       header,
+		pageSize:     pageSize,
+		usableSize:   pageSize - int32(header[20]),
+		textEncoding: binary.BigEndian.Uint32(header[56:60]),
+		pager:        newPager(file, pageSize),
+	}
+	return db, nil
+}
+
+func (db *Database) Close() error {
+	return db.file.Close()
+}
+
+func (db *Database) PageSize() int32 {
+	return db.pageSize
+}
+
+// PageCount returns the size of the database in pages as stored in the header at offset 28. The stored value is only
+// valid when the version-valid-for number at offset 92 matches the change counter, otherwise it comes from the file size
+func (db *Database) PageCount() uint32 {
+	pageCount := binary.BigEndian.Uint32(db.header[28:32])
+	if pageCount != 0 && binary.BigEndian.Uint32(db.header[92:96]) == db.FileChangeCounter() {
+		return pageCount
+	}
+	info, err := db.file.Stat()
+	if err != nil {
+		return pageCount
+	}
+	return uint32(info.Size() / int64(db.pageSize))
+}
+
+// FileChangeCounter returns the counter at offset 24 that is incremented whenever the file is modified
+func (db *Database) FileChangeCounter() uint32 {
+	return binary.BigEndian.Uint32(db.header[24:28])
+}
+
+// SchemaCookie returns the counter at offset 40 that is incremented whenever the schema changes
+func (db *Database) SchemaCookie() uint32 {
+	return binary.BigEndian.Uint32(db.header[40:44])
+}
+
+// SchemaFormat returns the schema format number at offset 44. From format 2 records can have fewer columns than their
+// table after ALTER TABLE ADD COLUMN, format 3 lets those added columns have defaults and format 4 adds DESC indexes
+// and the serial types 8 and 9 for the integers 0 and 1.
+func (db *Database) SchemaFormat() uint32 {
+	return binary.BigEndian.Uint32(db.header[44:48])
+}
+
+// FileFormatVersions returns the write and read versions at offsets 18 and 19, 1 for legacy rollback journal files
+// and 2 for WAL
+func (db *Database) FileFormatVersions() (byte, byte) {
+	return db.header[18], db.header[19]
+}
+
+// SoftwareVersion returns the SQLITE_VERSION_NUMBER at offset 96 of the library that last wrote the file
+func (db *Database) SoftwareVersion() uint32 {
+	return binary.BigEndian.Uint32(db.header[96:100])
+}
+
+// lockBytePage returns the number of the page holding the bytes at offset 2^30, which sqlite reserves for file locks.
+// Pages are still numbered and placed linearly, the page is simply never used, so only files over 1GB contain it.
+func (db *Database) lockBytePage() uint32 {
+	return uint32(1<<30/int64(db.pageSize)) + 1
+}
+
+// FreelistPageCount returns the number of unused pages according to the header, trunk and leaf pages together
+func (db *Database) FreelistPageCount() uint32 {
+	return binary.BigEndian.Uint32(db.header[36:40])
+}
+
+// FreelistTrunk is one trunk page of the freelist and the leaf pages it lists
+type FreelistTrunk struct {
+	PageNumber uint32
+	LeafPages  []uint32
+}
+
+// Freelist walks the chain of freelist trunk pages starting at the page number stored at offset 32 of the header.
+// The walk stops at a page number past the end of the file or after as many trunks as there are pages, so a corrupt
+// chain can't loop forever.
+func (db *Database) Freelist() ([]FreelistTrunk, error) {
+	var trunks []FreelistTrunk
+	pageCount := db.PageCount()
+	maxLeafCount := uint32(db.usableSize/4 - 2) // after the next trunk pointer and the leaf count
+	for trunkPage := binary.BigEndian.Uint32(db.header[32:36]); trunkPage != 0; {
+		if trunkPage > pageCount || uint32(len(trunks)) >= pageCount {
+			return trunks, fmt.Errorf("freelist trunk page %d is out of range", trunkPage)
+		}
+		if trunkPage == db.lockBytePage() {
+			return trunks, fmt.Errorf("freelist trunk page %d is the lock-byte page", trunkPage)
+		}
+		data, err := db.readBytesAtOffset(int64(trunkPage-1)*int64(db.pageSize), int(db.usableSize))
+		if err != nil {
+			return trunks, fmt.Errorf("reading freelist trunk page %d: %v", trunkPage, err)
+		}
+		leafCount := binary.BigEndian.Uint32(data[4:8])
+		if leafCount > maxLeafCount {
+			return trunks, fmt.Errorf("freelist trunk page %d lists %d leaf pages", trunkPage, leafCount)
+		}
+		trunk := FreelistTrunk{PageNumber: trunkPage}
+		for i := uint32(0); i < leafCount; i++ {
+			trunk.LeafPages = append(trunk.LeafPages, binary.BigEndian.Uint32(data[8+4*i:12+4*i]))
+		}
+		trunks = append(trunks, trunk)
+		trunkPage = binary.BigEndian.Uint32(data[0:4])
+	}
+	return trunks, nil
+}
+
+// TextEncoding returns the header text encoding number with its name, e.g. "1 (utf8)"
+func (db *Database) TextEncoding() string {
+	switch db.textEncoding {
+	case encodingUTF8:
+		return "1 (utf8)"
+	case encodingUTF16le:
+		return "2 (utf16le)"
+	case encodingUTF16be:
+		return "3 (utf16be)"
+	}
+	return fmt.Sprint(db.textEncoding)
+}
+
+// TableCount returns the number of rows in sqlite_schema, page 1 is the root page of the schema B-tree
+func (db *Database) TableCount() (int64, error) {
+	return db.countRecordsInBTree(1)
+}
+
+// RowIds returns the rowid of every row of tableName in ascending order, which is the order of the table B-tree
+func (db *Database) RowIds(tableName string) ([]int64, error) {
+	rootPage, createStatement, found, err := db.findTable(tableName)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("no such table: %s", tableName)
+	}
+	if isWithoutRowId(createStatement) {
+		return nil, fmt.Errorf("%s is a WITHOUT ROWID table", tableName)
+	}
+	return db.collectRowIds(rootPage, nil)
+}
+
+// Tables returns the table names, the internal sqlite_ tables like sqlite_sequence are left out unless includeInternal is set
+func (db *Database) Tables(includeInternal bool) ([]string, error) {
+	tableNames, err := db.getSchemaNames("table")
+	if err != nil || includeInternal {
+		return tableNames, err
+	}
+	var userTableNames []string
+	for _, name := range tableNames {
+		if !strings.HasPrefix(name, "sqlite_") {
+			userTableNames = append(userTableNames, name)
+		}
+	}
+	return userTableNames, nil
+}
+
+func (db *Database) Indexes() ([]string, error) {
+	return db.getSchemaNames("index")
+}
+
+// Schema returns the CREATE statements of every table and index, or only those of tableName when it isn't empty
+func (db *Database) Schema(tableName string) ([]string, error) {
+	return db.getSchemaStatements(tableName)
+}
+
+// Dump returns the lines of a SQL script that recreates the database, in the same layout as sqlite3's .dump
+func (db *Database) Dump() ([]string, error) {
+	lines := []string{"PRAGMA foreign_keys=OFF;", "BEGIN TRANSACTION;"}
+
+	// Columns of sqlite_schema: type, name, tbl_name, rootpage, sql
+	var schemaRows Rows
+	err := db.forEachSchemaRow(func(row []Value) bool {
+		schemaRows = append(schemaRows, row)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	var tableNames []string
+	for _, row := range schemaRows {
+		if len(row) < 5 || row[0].String() != "table" || row[4].IsNull() {
+			continue
+		}
+		name := row[1].String()
+		if name == "sqlite_sequence" {
+			continue // Its rows are dumped last, once the tables using AUTOINCREMENT exist
+		}
+		if !strings.HasPrefix(name, "sqlite_") {
+			lines = append(lines, row[4].String()+";")
+		}
+		tableNames = append(tableNames, name)
+		insertLines, err := db.dumpTableRows(name)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, insertLines...)
+	}
+	for _, row := range schemaRows {
+		if len(row) >= 5 && row[0].String() == "table" && row[1].String() == "sqlite_sequence" {
+			insertLines, err := db.dumpTableRows("sqlite_sequence")
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, insertLines...)
+		}
+	}
+
+	// Indexes, triggers and views go after the data so the INSERTs don't have to maintain them
+	for _, row := range schemaRows {
+		if len(row) < 5 || row[0].String() == "table" || row[4].IsNull() {
+			continue
+		}
+		lines = append(lines, row[4].String()+";")
+	}
+
+	return append(lines, "COMMIT;"), nil
+}
+
+// dumpTableRows returns one INSERT statement per row of tableName
+func (db *Database) dumpTableRows(tableName string) ([]string, error) {
+	var lines []string
+	rows, _, err := db.readDataFromMultipleColumns(tableName, []string{"*"}, nil, OrderBy{}, -1, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		literals := make([]string, len(row))
+		for i, value := range row {
+			literals[i] = value.SQLLiteral()
+		}
+		lines = append(lines, "INSERT INTO "+quoteIdentifierIfNeeded(tableName)+" VALUES("+strings.Join(literals, ",")+");")
+	}
+	return lines, nil
+}
+
+// SelectExpressions evaluates a SELECT without a FROM clause and returns its single row
+func (db *Database) SelectExpressions(expressions []string) (string, error) {
+	var values []string
+	for _, expression := range expressions {
+		value, err := db.evalConstantExpression(expression)
+		if err != nil {
+			return "", err
+		}
+		values = append(values, value.String())
+	}
+	return strings.Join(values, "|"), nil
+}
+
+// sqliteVersion formats the SQLITE_VERSION_NUMBER stored at offset 96 by the library that last wrote the file
+func (db *Database) sqliteVersion() string {
+	versionNumber := db.SoftwareVersion()
+	return fmt.Sprintf("%d.%d.%d", versionNumber/1000000, versionNumber/1000%1000, versionNumber%1000)
+}
+
+// ColumnNames returns the result column names of a SELECT, * expands to the declared columns of tableName
+// and every other column is named by its alias, which defaults to the column itself
+func (db *Database) ColumnNames(tableName string, colNames []string, aliases []string) []string {
+	var names []string
+	for i, colName := range colNames {
+		if colName != "*" {
+			names = append(names, aliases[i])
+			continue
+		}
+		columnDefs, _, _ := db.tableColumnDefs(tableName) // Query has already reported a table that can't be read
+		for _, colDef := range columnDefs {
+			names = append(names, columnDefName(colDef))
+		}
+	}
+	return names
+}
+
+// tableColumnDefs returns the column definitions from the CREATE TABLE statement of tableName
+func (db *Database) tableColumnDefs(tableName string) ([]string, bool, error) {
+	createStatement, found, err := db.tableCreateStatement(tableName)
+	if !found || err != nil {
+		return nil, false, err
+	}
+	return parseColumnDefs(createStatement), true, nil
+}
+
+// tableCreateStatement returns the CREATE TABLE statement of tableName as stored in sqlite_schema
+func (db *Database) tableCreateStatement(tableName string) (string, bool, error) {
+	_, createStatement, found, err := db.findTable(tableName)
+	return createStatement, found, err
+}
+
+// Columns returns the metadata of every column of tableName in declared order
+func (db *Database) Columns(tableName string) ([]Column, error) {
+	createStatement, found, err := db.tableCreateStatement(tableName)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("no such table: %s", tableName)
+	}
+	return parseColumns(createStatement), nil
+}
+
+// Pragma runs PRAGMA name(argument) and returns the result column names with the rows
+func (db *Database) Pragma(name string, argument string) ([]string, Rows, error) {
+	switch strings.ToLower(name) {
+	case "table_info":
+		// Like sqlite3, an unknown table gives no rows rather than an error
+		createStatement, _, err := db.tableCreateStatement(argument)
+		if err != nil {
+			return nil, nil, err
+		}
+		var rows Rows
+		for cid, column := range parseColumns(createStatement) {
+			notNull := int64(0)
+			if column.NotNull {
+				notNull = 1
+			}
+			defaultValue := Value{SerialType: 0, Data: nil}
+			if column.DefaultValue != "" {
+				defaultValue = Value{SerialType: 13, Data: column.DefaultValue}
+			}
+			rows = append(rows, []Value{
+				{SerialType: 6, Data: int64(cid)},
+				{SerialType: 13, Data: column.Name},
+				{SerialType: 13, Data: strings.ToUpper(column.Type)},
+				{SerialType: 6, Data: notNull},
+				defaultValue,
+				{SerialType: 6, Data: int64(column.PrimaryKey)},
+			})
+		}
+		return []string{"cid", "name", "type", "notnull", "dflt_value", "pk"}, rows, nil
+
+	case "page_count":
+		return []string{"page_count"}, Rows{{{SerialType: 6, Data: int64(db.PageCount())}}}, nil
+	case "page_size":
+		return []string{"page_size"}, Rows{{{SerialType: 6, Data: int64(db.PageSize())}}}, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported pragma: %s", name)
+}
+
+// Count returns the number of rows in tableName that satisfy the where clause
+func (db *Database) Count(tableName string, whereClause WhereClause) (int64, error) {
+	rootPage, createStatement, found, err := db.findTable(tableName)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, fmt.Errorf("no such table: %s", tableName)
+	}
+	if len(whereClause) == 0 {
+		return db.countRecordsInBTree(rootPage)
+	}
+	columnDefs := parseColumnDefs(createStatement)
+	if colName, found := findUnknownWhereColumn(columnDefs, whereClause); found {
+		return 0, fmt.Errorf("no such column: %s", colName)
+	}
+	return db.countMatchingRecordsInBTree(rootPage, db.newTableLayout(createStatement), resolveWhereClause(columnDefs, whereClause))
+}
+
+// Aggregate reduces one column of tableName with sum, avg, min or max
+func (db *Database) Aggregate(aggregate string, tableName string, colName string, whereClause WhereClause) (string, error) {
+	if err := db.checkColumns(tableName, []string{colName}, whereClause); err != nil {
+		return "", err
+	}
+	rows, found, err := db.readDataFromMultipleColumns(tableName, []string{colName}, whereClause, OrderBy{}, -1, 0)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("no such table: %s", tableName)
+	}
+	var values []Value
+	for _, row := range rows {
+		values = append(values, row[0])
+	}
+	return aggregateValues(aggregate, values).String(), nil
+}
+
+// checkColumns returns a "no such table" or "no such column" error unless every column of colNames and of the where
+// clause exists in tableName
+func (db *Database) checkColumns(tableName string, colNames []string, whereClause WhereClause) error {
+	_, createStatement, found, err := db.findTable(tableName)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("no such table: %s", tableName)
+	}
+	columnDefs := parseColumnDefs(createStatement)
+	if colName, found := findUnknownColumn(columnDefs, colNames); found {
+		return fmt.Errorf("no such column: %s", colName)
+	}
+	if colName, found := findUnknownWhereColumn(columnDefs, whereClause); found {
+		return fmt.Errorf("no such column: %s", colName)
+	}
+	return nil
+}
+
+// Query returns the typed values of the requested columns for every matching row, limit -1 means no limit and the
+// first offset matching rows are skipped
+func (db *Database) Query(tableName string, colNames []string, whereClause WhereClause, orderBy OrderBy, limit int, offset int) (Rows, error) {
+	if err := db.checkColumns(tableName, colNames, whereClause); err != nil {
+		return nil, err
+	}
+
+	// A single equality condition on a column with an index searches the index tree for the rowids
+	// and then looks those rows up in the table tree instead of scanning the whole table. Indexes of a
+	// WITHOUT ROWID table hold primary keys rather than rowids so those tables are always scanned.
+	createStatement, _, err := db.tableCreateStatement(tableName)
+	if err != nil {
+		return nil, err
+	}
+	if len(whereClause) == 1 && len(whereClause[0]) == 1 && whereClause[0][0].Operator == "=" && !whereClause[0][0].NoCase && !whereClause[0][0].Negate && orderBy.Column == "" && !isWithoutRowId(createStatement) {
+		key, ok := indexKey(parseColumnDefs(createStatement), whereClause[0][0])
+		var rowIds []string
+		found := false
+		if ok {
+			rowIds, found, err = db.getRowIdsFromIndexTree(tableName, whereClause[0][0].Column, key)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if found {
+			rowIds = rowIds[min(offset, len(rowIds)):]
+			if limit != -1 && len(rowIds) > limit {
+				rowIds = rowIds[:limit]
+			}
+			return db.readDataByRowIds(tableName, colNames, rowIds)
+		}
+	}
+
+	rows, found, err := db.readDataFromMultipleColumns(tableName, colNames, whereClause, orderBy, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("no such table: %s", tableName)
+	}
+	return rows, nil
+}
+
+// indexKey types the literal of an equality condition the way the column stores it so it can be searched for in an
+// index, the same conversion a table scan applies before comparing. It returns false when the index can't be used: the
+// right-hand side is another column, or the column's own collation orders the index differently than a binary compare.
+func indexKey(columnDefs []string, condition WhereCondition) (Value, bool) {
+	condition = resolveWhereClause(columnDefs, WhereClause{{condition}})[0][0]
+	if condition.ColIdx < 0 || condition.ColIdx >= len(columnDefs) || condition.ValueColIdx >= 0 || !isBinaryAscending(columnDefs[condition.ColIdx]) {
+		return Value{}, false
+	}
+	return literalValue(Value{}, condition.Value, condition.Quoted, condition.Blob, condition.Affinity), true
+}
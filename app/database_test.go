@@ -0,0 +1,336 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPageSize65536(t *testing.T) {
+	b := newTestDB(t, 65536)
+	var rows []testRow
+	for i := 1; i <= 3000; i++ {
+		rows = append(rows, testRow{rowId: int64(i), values: []any{nil, fmt.Sprintf("name %d", i)}})
+	}
+	b.addTable("people", "CREATE TABLE people(id integer primary key, name text)", rows...)
+	b.addTable("empty", "CREATE TABLE empty(id integer primary key)") // Its cell content area starts at 65536, stored as 0
+	db := b.open()
+
+	if db.PageSize() != 65536 {
+		t.Fatalf("PageSize() = %d, want 65536", db.PageSize())
+	}
+	if _, header, err := db.readBTreePage(1); err != nil || header.PageType != pageTypeTableLeaf {
+		t.Fatalf("page 1: header %+v, err %v", header, err)
+	}
+	count, err := db.Count("people", nil)
+	if err != nil || count != 3000 {
+		t.Errorf("Count(people) = %d, %v, want 3000", count, err)
+	}
+	if count, err := db.Count("empty", nil); err != nil || count != 0 {
+		t.Errorf("Count(empty) = %d, %v, want 0", count, err)
+	}
+	got := queryStrings(t, db, "people", []string{"id", "name"}, mustParseWhere(t, "id = 2999"))
+	if want := [][]string{{"2999", "name 2999"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("id = 2999 returned %v, want %v", got, want)
+	}
+	if problems, err := db.IntegrityCheck(); err != nil || len(problems) != 0 {
+		t.Errorf("IntegrityCheck() = %v, %v", problems, err)
+	}
+}
+
+func TestNegativeAndInt64BoundaryRowIds(t *testing.T) {
+	// Enough rows on 512-byte pages that the interior page keys include negative rowids
+	rowIds := []int64{math.MinInt64, math.MinInt64 + 1, -5}
+	for i := int64(-100); i <= 100; i++ {
+		if i != -5 {
+			rowIds = append(rowIds, i)
+		}
+	}
+	slices.Sort(rowIds)
+	rowIds = append(rowIds, math.MaxInt64-1, math.MaxInt64)
+	b := newTestDB(t, 512)
+	var rows []testRow
+	for _, rowId := range rowIds {
+		rows = append(rows, testRow{rowId: rowId, values: []any{nil, fmt.Sprint("row ", rowId)}})
+	}
+	rootPage := int32(b.addTable("t", "CREATE TABLE t(id integer primary key, v text)", rows...))
+	db := b.open()
+	if _, header, err := db.readBTreePage(rootPage); err != nil || header.PageType != pageTypeTableInterior {
+		t.Fatalf("root page %d: header %+v, err %v, want an interior page", rootPage, header, err)
+	}
+
+	got, err := db.RowIds("t")
+	if err != nil || !slices.Equal(got, rowIds) {
+		t.Fatalf("RowIds(t) = %v, %v, want %v", got, err, rowIds)
+	}
+	tests := []struct {
+		where string
+		want  [][]string
+	}{
+		{"rowid = -5", [][]string{{"-5", "row -5"}}},
+		{"id = -9223372036854775808", [][]string{{"-9223372036854775808", "row -9223372036854775808"}}},
+		{"id = 9223372036854775807", [][]string{{"9223372036854775807", "row 9223372036854775807"}}},
+		{"id < -99", [][]string{
+			{"-9223372036854775808", "row -9223372036854775808"},
+			{"-9223372036854775807", "row -9223372036854775807"},
+			{"-100", "row -100"},
+		}},
+		{"id > 100", [][]string{
+			{"9223372036854775806", "row 9223372036854775806"},
+			{"9223372036854775807", "row 9223372036854775807"},
+		}},
+		{"id between -6 and -4", [][]string{{"-6", "row -6"}, {"-5", "row -5"}, {"-4", "row -4"}}},
+	}
+	for _, tt := range tests {
+		if got := queryStrings(t, db, "t", []string{"id", "v"}, mustParseWhere(t, tt.where)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("WHERE %s returned %v, want %v", tt.where, got, tt.want)
+		}
+	}
+	for _, rowId := range []int64{math.MinInt64, -5, 0, math.MaxInt64} {
+		if _, found, err := db.findRowByRowId(rootPage, rowId); err != nil || !found {
+			t.Errorf("findRowByRowId(%d) = %v, %v", rowId, found, err)
+		}
+	}
+}
+
+func TestWithoutRowIdTable(t *testing.T) {
+	// The primary key is stored first and the other columns follow in declared order, rows are in key order
+	b := newTestDB(t, 512)
+	var keys [][]any
+	for i := 1; i <= 300; i++ {
+		keys = append(keys, []any{fmt.Sprintf("k%03d", i), i * 10, fmt.Sprint("b", i)})
+	}
+	b.addIndex("table", "w", "w", "CREATE TABLE w(a int, k text primary key, b text) WITHOUT ROWID", keys...)
+	db := b.open()
+
+	if count, err := db.Count("w", nil); err != nil || count != 300 {
+		t.Errorf("Count(w) = %d, %v, want 300", count, err)
+	}
+	got := queryStrings(t, db, "w", []string{"*"}, mustParseWhere(t, "k = 'k150'"))
+	if want := [][]string{{"1500", "k150", "b150"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("k = 'k150' returned %v, want %v", got, want)
+	}
+	got = queryStrings(t, db, "w", []string{"k", "a"}, mustParseWhere(t, "a >= 2990"))
+	if want := [][]string{{"k299", "2990"}, {"k300", "3000"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("a >= 2990 returned %v, want %v", got, want)
+	}
+}
+
+func TestEmptyTable(t *testing.T) {
+	b := newTestDB(t, 4096)
+	b.addTable("empty", "CREATE TABLE empty(id integer primary key, name text)")
+	b.addIndex("index", "empty_name", "empty", "CREATE INDEX empty_name ON empty(name)")
+	db := b.open()
+
+	for _, where := range []string{"", "name = 'x'", "id > 0"} {
+		var whereClause WhereClause
+		if where != "" {
+			whereClause = mustParseWhere(t, where)
+		}
+		if count, err := db.Count("empty", whereClause); err != nil || count != 0 {
+			t.Errorf("Count WHERE %q = %d, %v, want 0", where, count, err)
+		}
+		if rows := queryStrings(t, db, "empty", []string{"*"}, whereClause); len(rows) != 0 {
+			t.Errorf("Query WHERE %q returned %v, want no rows", where, rows)
+		}
+	}
+	if result, err := db.Aggregate("max", "empty", "name", nil); err != nil || result != "NULL" {
+		t.Errorf("max(name) = %q, %v, want NULL", result, err)
+	}
+	if rowIds, err := db.RowIds("empty"); err != nil || len(rowIds) != 0 {
+		t.Errorf("RowIds(empty) = %v, %v, want none", rowIds, err)
+	}
+	if count, err := db.TableCount(); err != nil || count != 2 {
+		t.Errorf("TableCount() = %d, %v, want the table and its index", count, err)
+	}
+}
+
+func TestSchemaSpanningSeveralPages(t *testing.T) {
+	// 200 tables on 512-byte pages give sqlite_schema several leaves under an interior page 1
+	b := newTestDB(t, 512)
+	var names []string
+	for i := 0; i < 200; i++ {
+		name := fmt.Sprintf("table_%03d", i)
+		var rows []testRow
+		for j := 1; j <= i%5; j++ {
+			rows = append(rows, testRow{rowId: int64(j), values: []any{fmt.Sprint(name, " row ", j)}})
+		}
+		b.addTable(name, fmt.Sprintf("CREATE TABLE %s(value text)", name), rows...)
+		names = append(names, name)
+	}
+	db := b.open()
+
+	if _, header, err := db.readBTreePage(1); err != nil || header.PageType != pageTypeTableInterior {
+		t.Fatalf("page 1: header %+v, err %v, want an interior page", header, err)
+	}
+	if count, err := db.TableCount(); err != nil || count != 200 {
+		t.Errorf("TableCount() = %d, %v, want 200", count, err)
+	}
+	tables, err := db.Tables(false)
+	if err != nil || !slices.Equal(tables, names) {
+		t.Errorf("Tables() = %v, %v, want %v", tables, err, names)
+	}
+	for _, i := range []int{0, 101, 199} {
+		name := names[i]
+		if count, err := db.Count(name, nil); err != nil || count != int64(i%5) {
+			t.Errorf("Count(%s) = %d, %v, want %d", name, count, err, i%5)
+		}
+		if statements, err := db.Schema(name); err != nil || len(statements) != 1 || !strings.Contains(statements[0], name) {
+			t.Errorf("Schema(%s) = %v, %v", name, statements, err)
+		}
+	}
+	got := queryStrings(t, db, "table_199", []string{"value"}, mustParseWhere(t, "rowid = 4"))
+	if want := [][]string{{"table_199 row 4"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("table_199 rowid 4 = %v, want %v", got, want)
+	}
+}
+
+// benchmarkDB is a table of 100k rows over a few hundred leaf pages
+func benchmarkDB(b *testing.B) *Database {
+	b.Helper()
+	builder := newTestDB(b, 4096)
+	rows := make([]testRow, 100000)
+	for i := range rows {
+		rows[i] = testRow{rowId: int64(i + 1), values: []any{nil, fmt.Sprintf("name %d", i+1), i % 100}}
+	}
+	builder.addTable("t", "CREATE TABLE t(id integer primary key, name text, score integer)", rows...)
+	return builder.open()
+}
+
+func BenchmarkCount(b *testing.B) {
+	db := benchmarkDB(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if count, err := db.Count("t", nil); err != nil || count != 100000 {
+			b.Fatalf("Count(t) = %d, %v", count, err)
+		}
+	}
+}
+
+func BenchmarkCountWhere(b *testing.B) {
+	db := benchmarkDB(b)
+	whereClause := mustParseWhere(b, "score = 7")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if count, err := db.Count("t", whereClause); err != nil || count != 1000 {
+			b.Fatalf("Count(t) WHERE score = 7 = %d, %v", count, err)
+		}
+	}
+}
+
+func BenchmarkSelectAll(b *testing.B) {
+	db := benchmarkDB(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rows, err := db.Query("t", []string{"id", "name", "score"}, nil, OrderBy{}, -1, 0)
+		if err != nil || len(rows) != 100000 {
+			b.Fatalf("Query(t) = %d rows, %v", len(rows), err)
+		}
+	}
+}
+
+func TestLargeRootPageNumber(t *testing.T) {
+	// Root page 2^24 + 3 needs a 4-byte integer in sqlite_schema and sits 8GB into the file, which stays sparse
+	const rootPage = 1<<24 + 3
+	b := newTestDB(t, 512)
+	b.addTableAt(rootPage, "far", "CREATE TABLE far(id integer primary key, v text)",
+		testRow{1, []any{nil, "a"}}, testRow{2, []any{nil, "b"}})
+	b.schema = append(b.schema,
+		[]any{"table", "beyond_int32", "beyond_int32", int64(1) << 40, "CREATE TABLE beyond_int32(v)"},
+		[]any{"table", "text_root", "text_root", "7", "CREATE TABLE text_root(v)"})
+	db := b.open()
+
+	if page, _, found, err := db.findTable("far"); err != nil || !found || page != rootPage {
+		t.Fatalf("findTable(far) = %d, %v, %v, want root page %d", page, found, err, rootPage)
+	}
+	if count, err := db.Count("far", nil); err != nil || count != 2 {
+		t.Errorf("Count(far) = %d, %v, want 2", count, err)
+	}
+	got := queryStrings(t, db, "far", []string{"v"}, mustParseWhere(t, "id = 2"))
+	if want := [][]string{{"b"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("far id = 2 returned %v, want %v", got, want)
+	}
+	for _, tableName := range []string{"beyond_int32", "text_root"} {
+		if count, err := db.Count(tableName, nil); err == nil {
+			t.Errorf("Count(%s) = %d with an invalid root page, want an error", tableName, count)
+		}
+	}
+}
+
+func TestIndexProbeUsesColumnAffinity(t *testing.T) {
+	b := newTestDB(t, 4096)
+	b.addTable("t", "CREATE TABLE t(id integer primary key, s text, n integer, b)",
+		testRow{1, []any{nil, "5", 5, []byte{0x05}}},
+		testRow{2, []any{nil, "10", 10, 10.0}},
+		testRow{3, []any{nil, "x", nil, nil}},
+		testRow{4, []any{nil, "5.0", 7, 5}},
+		testRow{5, []any{nil, "1e1", "abc", "1e1"}})
+	b.addIndex("index", "t_s", "t", "CREATE INDEX t_s ON t(s)",
+		[]any{"10", 2}, []any{"1e1", 5}, []any{"5", 1}, []any{"5.0", 4}, []any{"x", 3})
+	b.addIndex("index", "t_n", "t", "CREATE INDEX t_n ON t(n)",
+		[]any{nil, 3}, []any{5, 1}, []any{7, 4}, []any{10, 2}, []any{"abc", 5})
+	b.addIndex("index", "t_b", "t", "CREATE INDEX t_b ON t(b)",
+		[]any{nil, 3}, []any{5, 4}, []any{10.0, 2}, []any{"1e1", 5}, []any{[]byte{0x05}, 1})
+	db := b.open()
+
+	// Expected rows are what sqlite3 returns for the same data
+	tests := []struct {
+		where string
+		want  [][]string
+	}{
+		{"s = 5", [][]string{{"1"}}},
+		{"s = '5'", [][]string{{"1"}}},
+		{"s = 5.0", [][]string{{"4"}}},
+		{"s = x'35'", [][]string{}},
+		{"n = '5'", [][]string{{"1"}}},
+		{"n = '5.0'", [][]string{{"1"}}},
+		{"n = 'abc'", [][]string{{"5"}}},
+		{"b = 5", [][]string{{"4"}}},
+		{"b = '5'", [][]string{}},
+		{"b = 10", [][]string{{"2"}}},
+		{"b = '1e1'", [][]string{{"5"}}},
+		{"b = x'05'", [][]string{{"1"}}},
+	}
+	for _, tt := range tests {
+		if got := queryStrings(t, db, "t", []string{"id"}, mustParseWhere(t, tt.where)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("WHERE %s returned %v, want %v", tt.where, got, tt.want)
+		}
+	}
+}
+
+func TestBlobLiteralsCompareAsBlobs(t *testing.T) {
+	b := newTestDB(t, 4096)
+	b.addTable("t", "CREATE TABLE t(id integer primary key, s text, b blob, n)",
+		testRow{1, []any{nil, "AB", []byte{0xab}, "AB"}},
+		testRow{2, []any{nil, "ab", []byte{0xab}, []byte{0xab}}},
+		testRow{3, []any{nil, "x", []byte{0x00}, 3}})
+	db := b.open()
+
+	// Without an index every row is scanned, expected rows are what sqlite3 returns for the same data
+	tests := []struct {
+		where string
+		want  [][]string
+	}{
+		{"s = x'AB'", [][]string{}},
+		{"b = 'AB'", [][]string{}},
+		{"b = x'AB'", [][]string{{"1"}, {"2"}}},
+		{"b = x'ab'", [][]string{{"1"}, {"2"}}},
+		{"n = x'AB'", [][]string{{"2"}}},
+		{"n = 'AB'", [][]string{{"1"}}},
+		{"b > x'00'", [][]string{{"1"}, {"2"}}},
+		{"b IN (x'AB', 'x')", [][]string{{"1"}, {"2"}}},
+		{"s IN (x'AB', 'x')", [][]string{{"3"}}},
+		{"b BETWEEN x'01' AND x'FF'", [][]string{{"1"}, {"2"}}},
+	}
+	for _, tt := range tests {
+		if got := queryStrings(t, db, "t", []string{"id"}, mustParseWhere(t, tt.where)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("WHERE %s returned %v, want %v", tt.where, got, tt.want)
+		}
+	}
+}
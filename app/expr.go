@@ -0,0 +1,596 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Expression is a parsed result column like price * quantity. A node is either an operator applied to its operands,
+// a function called with its operands as arguments, a column reference or a literal.
+type Expression struct {
+	Operator string // +, -, *, / or ||, empty for the other kinds of node
+	Function string // Lowercased name of a function in scalarFunctions
+	Operands []*Expression
+	Column   string // Column reference as written, ColIdx is its index in the row the expression is evaluated on
+	ColIdx   int
+	Literal  Value
+}
+
+// binaryOperators lists the operators from the loosest binding to the tightest, operators on one level are left
+// associative
+var binaryOperators = [][]string{
+	{"+", "-"},
+	{"*", "/"},
+	{"||"},
+}
+
+// scalarFunction is a function usable in expressions, it is called with argCount evaluated arguments
+type scalarFunction struct {
+	argCount int
+	apply    func(args []Value) Value
+}
+
+// scalarFunctions are the functions expressions can call, by lowercased name
+var scalarFunctions = map[string]scalarFunction{
+	"length": {argCount: 1, apply: lengthFunction},
+	"upper":  {argCount: 1, apply: upperFunction},
+	"lower":  {argCount: 1, apply: lowerFunction},
+	"typeof": {argCount: 1, apply: typeofFunction},
+}
+
+// lexExpression splits an expression into string and blob literals, numbers, identifiers (qualified or quoted) and
+// operators
+func lexExpression(expression string) ([]string, error) {
+	var tokens []string
+	isIdentifierStart := func(c byte) bool {
+		return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+	}
+	isDigit := func(c byte) bool {
+		return c >= '0' && c <= '9'
+	}
+	// skipQuoted returns the index after the quote that closes the one at start, a doubled quote is an escaped one
+	skipQuoted := func(start int, closing byte) (int, error) {
+		for i := start + 1; i < len(expression); i++ {
+			if expression[i] != closing {
+				continue
+			}
+			if closing != ']' && i+1 < len(expression) && expression[i+1] == closing {
+				i++
+				continue
+			}
+			return i + 1, nil
+		}
+		return 0, fmt.Errorf("unrecognized token: %s", expression[start:])
+	}
+
+	for i := 0; i < len(expression); {
+		c := expression[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case c == '\'' || (c == 'x' || c == 'X') && i+1 < len(expression) && expression[i+1] == '\'':
+			end, err := skipQuoted(strings.IndexByte(expression[i:], '\'')+i, '\'')
+			if err != nil {
+				return nil, err
+			}
+			i = end
+		case isDigit(c) || c == '.' && i+1 < len(expression) && isDigit(expression[i+1]):
+			for i < len(expression) && (isDigit(expression[i]) || expression[i] == '.') {
+				i++
+			}
+			if i < len(expression) && (expression[i] == 'e' || expression[i] == 'E') {
+				i++
+				if i < len(expression) && (expression[i] == '+' || expression[i] == '-') {
+					i++
+				}
+				for i < len(expression) && isDigit(expression[i]) {
+					i++
+				}
+			}
+		case isIdentifierStart(c) || c == '"' || c == '`' || c == '[':
+			// An identifier is one or more parts joined by dots, each part bare or quoted
+			for {
+				switch expression[i] {
+				case '"', '`', '[':
+					closing := expression[i]
+					if closing == '[' {
+						closing = ']'
+					}
+					end, err := skipQuoted(i, closing)
+					if err != nil {
+						return nil, err
+					}
+					i = end
+				default:
+					for i < len(expression) && (isIdentifierStart(expression[i]) || isDigit(expression[i]) || expression[i] == '$') {
+						i++
+					}
+				}
+				if i+1 >= len(expression) || expression[i] != '.' {
+					break
+				}
+				if next := expression[i+1]; !isIdentifierStart(next) && next != '"' && next != '`' && next != '[' {
+					break
+				}
+				i++
+			}
+		case c == '|' && i+1 < len(expression) && expression[i+1] == '|':
+			i += 2
+		case strings.IndexByte("+-*/(),", c) != -1:
+			i++
+		default:
+			return nil, fmt.Errorf("unrecognized token: \"%s\"", expression[i:i+1])
+		}
+		tokens = append(tokens, expression[start:i])
+	}
+	return tokens, nil
+}
+
+// isComputedExpression reports whether a result column is more than a bare column or *, those are read straight
+// from the table without evaluating anything
+func isComputedExpression(expression string) bool {
+	if _, column := splitQualifiedName(expression); column == "*" {
+		return false
+	}
+	tokens, err := lexExpression(expression)
+	if err != nil || len(tokens) != 1 {
+		return true // A malformed expression is reported when it is parsed
+	}
+	if strings.ToLower(tokens[0]) == "null" {
+		return true
+	}
+	c := tokens[0][0]
+	return !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '"' || c == '`' || c == '[')
+}
+
+// expressionParser is a recursive descent parser over the tokens of one expression
+type expressionParser struct {
+	tokens []string
+	pos    int
+}
+
+// parseExpression parses a result column expression, columns are left unresolved with ColIdx -1
+func parseExpression(expression string) (*Expression, error) {
+	tokens, err := lexExpression(expression)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("incomplete input")
+	}
+	p := &expressionParser{tokens: tokens}
+	parsed, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("near \"%s\": syntax error", p.tokens[p.pos])
+	}
+	return parsed, nil
+}
+
+// peek returns the next token without consuming it, empty at the end of the expression
+func (p *expressionParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+// parseBinary parses the operators of binaryOperators[level] and everything binding tighter
+func (p *expressionParser) parseBinary(level int) (*Expression, error) {
+	if level == len(binaryOperators) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		operator := p.peek()
+		found := false
+		for _, candidate := range binaryOperators[level] {
+			found = found || operator == candidate
+		}
+		if !found {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &Expression{Operator: operator, Operands: []*Expression{left, right}, ColIdx: -1}
+	}
+}
+
+// parseUnary parses a leading sign, -x is evaluated as 0 - x which gives the same result for every operand
+func (p *expressionParser) parseUnary() (*Expression, error) {
+	switch p.peek() {
+	case "-":
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		zero := &Expression{ColIdx: -1, Literal: Value{SerialType: 6, Data: int64(0)}}
+		return &Expression{Operator: "-", Operands: []*Expression{zero, operand}, ColIdx: -1}, nil
+	case "+":
+		p.pos++
+		return p.parseUnary()
+	}
+	return p.parsePrimary()
+}
+
+// parsePrimary parses a parenthesized expression, a literal or a column reference
+func (p *expressionParser) parsePrimary() (*Expression, error) {
+	token := p.peek()
+	if token == "" {
+		return nil, fmt.Errorf("incomplete input")
+	}
+	p.pos++
+	lowerToken := strings.ToLower(token)
+	switch {
+	case token == "(":
+		inner, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("incomplete input")
+		}
+		p.pos++
+		return inner, nil
+	case token[0] == '\'':
+		return &Expression{ColIdx: -1, Literal: Value{SerialType: 13, Data: unquoteStringLiteral(token)}}, nil
+	case strings.HasPrefix(lowerToken, "x'"):
+		blob, err := hex.DecodeString(token[2 : len(token)-1])
+		if err != nil {
+			return nil, fmt.Errorf("malformed blob literal: %s", token)
+		}
+		return &Expression{ColIdx: -1, Literal: Value{SerialType: 12, Data: blob}}, nil
+	case token[0] >= '0' && token[0] <= '9' || token[0] == '.':
+		if integer, err := strconv.ParseInt(token, 10, 64); err == nil {
+			return &Expression{ColIdx: -1, Literal: Value{SerialType: 6, Data: integer}}, nil
+		}
+		real, err := strconv.ParseFloat(token, 64)
+		if err != nil && !errors.Is(err, strconv.ErrRange) {
+			return nil, fmt.Errorf("unrecognized token: \"%s\"", token)
+		}
+		return &Expression{ColIdx: -1, Literal: Value{SerialType: 7, Data: real}}, nil
+	case lowerToken == "null":
+		return &Expression{ColIdx: -1, Literal: Value{SerialType: 0, Data: nil}}, nil
+	case strings.IndexByte("+-*/|),", token[0]) == -1 && p.peek() == "(":
+		return p.parseFunctionCall(token)
+	case strings.IndexByte("+-*/|),", token[0]) == -1:
+		return &Expression{Column: token, ColIdx: -1}, nil
+	}
+	return nil, fmt.Errorf("near \"%s\": syntax error", token)
+}
+
+// parseFunctionCall parses the parenthesized argument list of a call to name, the function has to be one of
+// scalarFunctions and take that many arguments
+func (p *expressionParser) parseFunctionCall(name string) (*Expression, error) {
+	function, ok := scalarFunctions[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("no such function: %s", name)
+	}
+	p.pos++ // (
+	call := &Expression{Function: strings.ToLower(name), ColIdx: -1}
+	if p.peek() == ")" {
+		p.pos++
+	} else {
+		for {
+			arg, err := p.parseBinary(0)
+			if err != nil {
+				return nil, err
+			}
+			call.Operands = append(call.Operands, arg)
+			if separator := p.peek(); separator == ")" {
+				p.pos++
+				break
+			} else if separator != "," {
+				return nil, fmt.Errorf("incomplete input")
+			}
+			p.pos++
+		}
+	}
+	if len(call.Operands) != function.argCount {
+		return nil, fmt.Errorf("wrong number of arguments to function %s()", name)
+	}
+	return call, nil
+}
+
+// resolveColumns sets ColIdx of every column reference in the expression, resolve reports columns it doesn't know
+func (e *Expression) resolveColumns(resolve func(colName string) (int, error)) error {
+	if e.Column != "" {
+		colIdx, err := resolve(e.Column)
+		if err != nil {
+			return err
+		}
+		e.ColIdx = colIdx
+	}
+	for _, operand := range e.Operands {
+		if err := operand.resolveColumns(resolve); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evaluate computes the expression for one row
+func (e *Expression) evaluate(rowValues []Value) Value {
+	switch {
+	case e.Function != "":
+		args := make([]Value, len(e.Operands))
+		for i, operand := range e.Operands {
+			args[i] = operand.evaluate(rowValues)
+		}
+		return scalarFunctions[e.Function].apply(args)
+	case e.Operator == "||":
+		return evaluateConcat(e.Operands[0].evaluate(rowValues), e.Operands[1].evaluate(rowValues))
+	case e.Operator != "":
+		return evaluateArithmetic(e.Operator, e.Operands[0].evaluate(rowValues), e.Operands[1].evaluate(rowValues))
+	case e.Column != "":
+		return rowValues[e.ColIdx]
+	}
+	return e.Literal
+}
+
+// numericValue converts an operand of arithmetic to a number like sqlite does: text and blobs are read as the longest
+// number at their start, ignoring leading spaces, and are 0 when they don't start with one
+func numericValue(value Value) Value {
+	var s string
+	switch data := value.Data.(type) {
+	case int64, float64:
+		return value
+	case string:
+		s = data
+	case []byte:
+		s = string(data)
+	}
+	s = strings.TrimLeft(s, " \t\n\r\f\v")
+	end, digits, isReal := 0, 0, false
+	if end < len(s) && (s[end] == '+' || s[end] == '-') {
+		end++
+	}
+	for ; end < len(s) && (s[end] >= '0' && s[end] <= '9' || s[end] == '.' && !isReal); end++ {
+		if s[end] == '.' {
+			isReal = true
+		} else {
+			digits++
+		}
+	}
+	if digits == 0 {
+		return Value{SerialType: 6, Data: int64(0)}
+	}
+	if end < len(s) && (s[end] == 'e' || s[end] == 'E') {
+		exponentEnd := end + 1
+		if exponentEnd < len(s) && (s[exponentEnd] == '+' || s[exponentEnd] == '-') {
+			exponentEnd++
+		}
+		if exponentEnd < len(s) && s[exponentEnd] >= '0' && s[exponentEnd] <= '9' {
+			for end = exponentEnd; end < len(s) && s[end] >= '0' && s[end] <= '9'; end++ {
+			}
+			isReal = true
+		}
+	}
+	if !isReal {
+		if integer, err := strconv.ParseInt(s[:end], 10, 64); err == nil {
+			return Value{SerialType: 6, Data: integer}
+		}
+	}
+	real, _ := strconv.ParseFloat(s[:end], 64) // Out of range integers become reals like in sqlite
+	return Value{SerialType: 7, Data: real}
+}
+
+// evaluateArithmetic applies +, -, * or / to two values. NULL in gives NULL out and so does dividing by zero. Two
+// integers give an integer, with / rounding towards zero, unless the result overflows and becomes a real.
+func evaluateArithmetic(operator string, a Value, b Value) Value {
+	if a.IsNull() || b.IsNull() {
+		return Value{SerialType: 0, Data: nil}
+	}
+	a, b = numericValue(a), numericValue(b)
+	x, xIsInt := a.Data.(int64)
+	y, yIsInt := b.Data.(int64)
+	if xIsInt && yIsInt {
+		var result int64
+		overflow := false
+		switch operator {
+		case "+":
+			result = x + y
+			overflow = (x > 0 && y > 0 && result < 0) || (x < 0 && y < 0 && result >= 0)
+		case "-":
+			result = x - y
+			overflow = (x >= 0 && y < 0 && result < 0) || (x < 0 && y > 0 && result >= 0)
+		case "*":
+			result = x * y
+			overflow = x != 0 && (result/x != y || x == -1 && y == math.MinInt64)
+		case "/":
+			if y == 0 {
+				return Value{SerialType: 0, Data: nil}
+			}
+			if x == math.MinInt64 && y == -1 {
+				overflow = true
+			} else {
+				result = x / y
+			}
+		}
+		if !overflow {
+			return Value{SerialType: 6, Data: result}
+		}
+	}
+
+	toFloat := func(value Value) float64 {
+		if integer, ok := value.Data.(int64); ok {
+			return float64(integer)
+		}
+		return value.Data.(float64)
+	}
+	x2, y2 := toFloat(a), toFloat(b)
+	var result float64
+	switch operator {
+	case "+":
+		result = x2 + y2
+	case "-":
+		result = x2 - y2
+	case "*":
+		result = x2 * y2
+	case "/":
+		if y2 == 0 {
+			return Value{SerialType: 0, Data: nil}
+		}
+		result = x2 / y2
+	}
+	if math.IsNaN(result) {
+		return Value{SerialType: 0, Data: nil} // Like Inf - Inf
+	}
+	return Value{SerialType: 7, Data: result}
+}
+
+// evaluateConcat joins two values as text, numbers in the form they are printed and blobs as their raw bytes. NULL
+// concatenated with anything is NULL.
+func evaluateConcat(a Value, b Value) Value {
+	if a.IsNull() || b.IsNull() {
+		return Value{SerialType: 0, Data: nil}
+	}
+	return Value{SerialType: 13, Data: textValue(a) + textValue(b)}
+}
+
+// textValue is a value converted to text the way sqlite casts it, numbers in their printed form and blobs as their
+// raw bytes
+func textValue(value Value) string {
+	if blob, ok := value.Data.([]byte); ok {
+		return string(blob)
+	}
+	return value.String()
+}
+
+// lengthFunction is length(x): the number of characters of text, bytes of a blob and characters of a number's text
+func lengthFunction(args []Value) Value {
+	switch data := args[0].Data.(type) {
+	case nil:
+		return args[0]
+	case []byte:
+		return Value{SerialType: 6, Data: int64(len(data))}
+	}
+	return Value{SerialType: 6, Data: int64(utf8.RuneCountInString(textValue(args[0])))}
+}
+
+// upperFunction is upper(x), like sqlite without ICU only ASCII letters change case
+func upperFunction(args []Value) Value {
+	if args[0].IsNull() {
+		return args[0]
+	}
+	return Value{SerialType: 13, Data: changeASCIICase(textValue(args[0]), 'a', 'A')}
+}
+
+// lowerFunction is lower(x), the ASCII-only counterpart of upperFunction
+func lowerFunction(args []Value) Value {
+	if args[0].IsNull() {
+		return args[0]
+	}
+	return Value{SerialType: 13, Data: changeASCIICase(textValue(args[0]), 'A', 'a')}
+}
+
+// changeASCIICase moves the 26 letters starting at from to the ones starting at to, every other byte is kept so
+// text that isn't valid UTF-8 survives unchanged
+func changeASCIICase(s string, from byte, to byte) string {
+	changed := []byte(s)
+	for i, c := range changed {
+		if c >= from && c < from+26 {
+			changed[i] = c - from + to
+		}
+	}
+	return string(changed)
+}
+
+// typeofFunction is typeof(x), the storage class of the value: null, integer, real, text or blob
+func typeofFunction(args []Value) Value {
+	return Value{SerialType: 13, Data: storageClassName(args[0].SerialType)}
+}
+
+// QueryExpressions runs a SELECT over one table whose result columns are expressions of its columns like
+// price * quantity. The columns the expressions refer to are read with Query and every expression is evaluated on
+// each of its rows. It returns the result column names along with the rows.
+func (db *Database) QueryExpressions(tableRef TableRef, expressions []string, headers []string, whereClause WhereClause, orderBy OrderBy, limit int, offset int) ([]string, Rows, error) {
+	columnDefs, found, err := db.tableColumnDefs(tableRef.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !found {
+		return nil, nil, fmt.Errorf("no such table: %s", tableRef.Name)
+	}
+
+	// colNames are the columns the expressions read, in the order Query returns them
+	var colNames []string
+	addColumn := func(column string) int {
+		for i, colName := range colNames {
+			if strings.EqualFold(colName, column) {
+				return i
+			}
+		}
+		colNames = append(colNames, column)
+		return len(colNames) - 1
+	}
+	resolve := func(colName string) (int, error) {
+		column, ok := stripTableQualifier(tableRef, unquoteIdentifier(colName))
+		if !ok {
+			return -1, fmt.Errorf("no such column: %s", colName)
+		}
+		return addColumn(column), nil
+	}
+
+	var names []string
+	var parsed []*Expression
+	for i, expression := range expressions {
+		if qualifier, column := splitQualifiedName(expression); column == "*" {
+			if qualifier != "" && !strings.EqualFold(qualifier, tableRef.Name) && !strings.EqualFold(qualifier, tableRef.Alias) {
+				return nil, nil, fmt.Errorf("no such table: %s", qualifier)
+			}
+			for _, colDef := range columnDefs {
+				name := columnDefName(colDef)
+				parsed = append(parsed, &Expression{Column: name, ColIdx: addColumn(name)})
+				names = append(names, name)
+			}
+			continue
+		}
+		parsedExpression, err := parseExpression(expression)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := parsedExpression.resolveColumns(resolve); err != nil {
+			return nil, nil, err
+		}
+		parsed = append(parsed, parsedExpression)
+		name := headers[i]
+		if parsedExpression.Column != "" && name == expression {
+			_, name = splitQualifiedName(unquoteIdentifier(name)) // A bare column is named without its table
+		}
+		names = append(names, name)
+	}
+
+	if len(colNames) == 0 && len(columnDefs) > 0 {
+		// Constant expressions still give one result per row and rows without any column are dropped by the scan
+		addColumn(columnDefName(columnDefs[0]))
+	}
+	rows, err := db.Query(tableRef.Name, colNames, whereClause, orderBy, limit, offset)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, rowValues := range rows {
+		values := make([]Value, len(parsed))
+		for j, expression := range parsed {
+			values[j] = expression.evaluate(rowValues)
+		}
+		rows[i] = values
+	}
+	return names, rows, nil
+}
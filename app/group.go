@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// groupExpression is a result column of a grouped query: count(*), an aggregate over a column or a bare column,
+// colIdx is the column in the table's rows and -1 for count(*)
+type groupExpression struct {
+	aggregate string // count, sum, avg, min or max, empty for a bare column
+	colIdx    int
+}
+
+// parseGroupExpression resolves an expression of a grouped query against the table's columns, whitespace inside it
+// has already been removed so COUNT( * ) arrives as COUNT(*)
+func parseGroupExpression(columnDefs []string, expression string) (groupExpression, error) {
+	if strings.ToLower(expression) == "count(*)" {
+		return groupExpression{aggregate: "count", colIdx: -1}, nil
+	}
+	aggregate, colName, ok := parseAggregate(expression)
+	if !ok {
+		colName = unquoteIdentifier(expression)
+	}
+	colIdx := findColumnIndex(columnDefs, colName)
+	if colIdx == -1 || colIdx >= len(columnDefs) {
+		return groupExpression{}, fmt.Errorf("no such column: %s", colName)
+	}
+	return groupExpression{aggregate: aggregate, colIdx: colIdx}, nil
+}
+
+// evaluate computes the expression over the rows of one group. A bare column takes its value from rows[bareRow], which
+// is NULL when there are no rows, and is the same for every row when it is the grouping column.
+func (e groupExpression) evaluate(rows Rows, bareRow int) Value {
+	if e.colIdx == -1 {
+		return Value{SerialType: 6, Data: int64(len(rows))}
+	}
+	if e.aggregate == "" {
+		if bareRow >= len(rows) {
+			return Value{}
+		}
+		return rows[bareRow][e.colIdx]
+	}
+	values := make([]Value, len(rows))
+	for i, row := range rows {
+		values[i] = row[e.colIdx]
+	}
+	return aggregateValues(e.aggregate, values)
+}
+
+// evaluatePlan computes every expression of plan over the rows of one group. Bare columns take their values from one
+// row like in sqlite: the first row holding the result of the last min() or max() of plan, or else the first row.
+func evaluatePlan(plan []groupExpression, rows Rows) []Value {
+	values := make([]Value, len(plan))
+	bareRow := 0
+	for i, e := range plan {
+		values[i] = e.evaluate(rows, 0)
+		if (e.aggregate == "min" || e.aggregate == "max") && !values[i].IsNull() {
+			bareRow = slices.IndexFunc(rows, func(row []Value) bool {
+				return compareTypedValues(row[e.colIdx], values[i]) == 0
+			})
+		}
+	}
+	for i, e := range plan {
+		if e.aggregate == "" {
+			values[i] = e.evaluate(rows, bareRow)
+		}
+	}
+	return values
+}
+
+// groupKey is the bucket of a grouping value. The storage class is part of it so the text 'NULL' and NULL, or 1 and
+// '1', end up in different groups, and numbers are normalised like joinKey does so 1 and 1.0 share one.
+func groupKey(value Value) string {
+	return fmt.Sprint(storageClassRank(value)) + ":" + joinKey(value)
+}
+
+// QueryAggregates computes several aggregates like SELECT count(*), min(v), max(v) over the rows of tableName that
+// match the where clause, the whole table being one group. The result is a single row even when no row matches. A
+// bare column next to the aggregates takes its value from one of the rows like in sqlite, see evaluatePlan.
+func (db *Database) QueryAggregates(tableName string, expressions []string, whereClause WhereClause) ([]Value, error) {
+	columnDefs, found, err := db.tableColumnDefs(tableName)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("no such table: %s", tableName)
+	}
+	var plan []groupExpression
+	for _, expression := range expressions {
+		groupExpression, err := parseGroupExpression(columnDefs, expression)
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, groupExpression)
+	}
+
+	rows, err := db.Query(tableName, []string{"*"}, whereClause, OrderBy{}, -1, 0)
+	if err != nil {
+		return nil, err
+	}
+	return evaluatePlan(plan, rows), nil
+}
+
+// QueryGroups runs SELECT expressions FROM tableName WHERE ... GROUP BY groupColumn HAVING having. Rows are grouped by
+// the value of groupColumn and the groups come out in the order of that value. The having clause is checked against
+// each group with its columns being expressions like COUNT(*) or a column of the group.
+func (db *Database) QueryGroups(tableName string, expressions []string, groupColumn string, whereClause WhereClause, having WhereClause) (Rows, error) {
+	columnDefs, found, err := db.tableColumnDefs(tableName)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("no such table: %s", tableName)
+	}
+	groupColIdx := findColumnIndex(columnDefs, groupColumn)
+	if groupColIdx == -1 || groupColIdx >= len(columnDefs) {
+		return nil, fmt.Errorf("no such column: %s", groupColumn)
+	}
+
+	// HAVING refers to expressions by their text, each one gets a slot after the result columns
+	havingExpressions := []string{}
+	resolvedHaving := resolveWhereClauseWith(having, func(expression string) int {
+		expression = strings.ReplaceAll(expression, " ", "")
+		for i, known := range havingExpressions {
+			if known == expression {
+				return len(expressions) + i
+			}
+		}
+		havingExpressions = append(havingExpressions, expression)
+		return len(expressions) + len(havingExpressions) - 1
+	})
+	var plan []groupExpression
+	for _, expression := range append(append([]string{}, expressions...), havingExpressions...) {
+		groupExpression, err := parseGroupExpression(columnDefs, expression)
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, groupExpression)
+	}
+
+	rows, err := db.Query(tableName, []string{"*"}, whereClause, OrderBy{}, -1, 0)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	groups := make(map[string]Rows)
+	for _, row := range rows {
+		key := groupKey(row[groupColIdx])
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], row)
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return compareTypedValues(groups[keys[i]][0][groupColIdx], groups[keys[j]][0][groupColIdx]) < 0
+	})
+
+	var result Rows
+	for _, key := range keys {
+		values := evaluatePlan(plan, groups[key])
+		if matchesWhereClause(values, resolvedHaving) {
+			result = append(result, values[:len(expressions)])
+		}
+	}
+	return result, nil
+}
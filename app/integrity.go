@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// maxFragmentedFreeBytes is the most fragmented free bytes sqlite lets a page collect before it defragments it
+const maxFragmentedFreeBytes = 60
+
+// IntegrityCheck walks the B-tree of sqlite_schema and of every table and index from its root page and checks the
+// layout of each page it reaches. It returns one line per anomaly prefixed with the page number, nothing when every
+// page is consistent. Only the page headers, cell pointers and freeblocks are checked, not the records.
+func (db *Database) IntegrityCheck() ([]string, error) {
+	roots := []int32{1}
+	var problems []string
+	err := db.forEachSchemaRow(func(row []Value) bool {
+		if rootPage, ok := row[3].Data.(int64); !ok || rootPage == 0 {
+			return true // Views and triggers have no B-tree
+		}
+		rootPage, err := schemaRootPage(row)
+		if err != nil {
+			problems = append(problems, err.Error())
+			return true
+		}
+		roots = append(roots, rootPage)
+		return true
+	})
+	if err != nil {
+		return problems, err
+	}
+
+	visited := make(map[int32]bool)
+	for _, rootPage := range roots {
+		problems = append(problems, db.checkBTree(rootPage, visited)...)
+	}
+	return problems, nil
+}
+
+// checkBTree checks the page and then its children, a page that was already visited is reported as shared by two
+// parents instead of being walked again so a cycle can't loop forever
+func (db *Database) checkBTree(pageNumber int32, visited map[int32]bool) []string {
+	if visited[pageNumber] {
+		return []string{fmt.Sprintf("page %d: referenced more than once", pageNumber)}
+	}
+	visited[pageNumber] = true
+	if err := db.checkPageNumber(pageNumber); err != nil {
+		return []string{err.Error()}
+	}
+	page, header, err := db.readBTreePage(pageNumber)
+	if err != nil {
+		return []string{fmt.Sprintf("page %d: %v", pageNumber, err)}
+	}
+	switch header.PageType {
+	case pageTypeIndexInterior, pageTypeTableInterior, pageTypeIndexLeaf, pageTypeTableLeaf:
+	default:
+		return []string{fmt.Sprintf("page %d: invalid page type %d", pageNumber, header.PageType)}
+	}
+
+	var problems []string
+	for _, problem := range db.checkPageLayout(page, header) {
+		problems = append(problems, fmt.Sprintf("page %d: %s", pageNumber, problem))
+	}
+	if !header.isInterior() {
+		return problems
+	}
+	for i := int32(0); i < int32(header.CellCount); i++ {
+		cellOffset, err := db.getCellContentOffset(page, header.cellPointerOffset(i))
+		if err != nil {
+			continue // Already reported by checkPageLayout
+		}
+		leftChildPageNumber, err := db.getLeftChildPageNumber(page, cellOffset)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("page %d: cell %d: %v", pageNumber, i, err))
+			continue
+		}
+		problems = append(problems, db.checkBTree(leftChildPageNumber, visited)...)
+	}
+	rightChildPageNumber, err := db.getRightmostChildPageNumber(header)
+	if err != nil {
+		return append(problems, fmt.Sprintf("page %d: rightmost pointer: %v", pageNumber, err))
+	}
+	return append(problems, db.checkBTree(rightChildPageNumber, visited)...)
+}
+
+// checkPageLayout checks that the cell content area starts after the cell pointer array, that every cell pointer
+// points into the content area, and that the freeblock chain stays in the content area in ascending order without
+// overlapping blocks
+func (db *Database) checkPageLayout(page []byte, header PageHeader) []string {
+	var problems []string
+	cellPointerArrayEnd := header.cellPointerOffset(int32(header.CellCount))
+	if header.CellContentStart < cellPointerArrayEnd || header.CellContentStart > db.usableSize {
+		problems = append(problems, fmt.Sprintf("cell content starts at %d, the %d cell pointers end at %d", header.CellContentStart, header.CellCount, cellPointerArrayEnd))
+	}
+	if header.FragmentedFreeBytes > maxFragmentedFreeBytes {
+		problems = append(problems, fmt.Sprintf("%d fragmented free bytes, more than %d", header.FragmentedFreeBytes, maxFragmentedFreeBytes))
+	}
+
+	for i := int32(0); i < int32(header.CellCount); i++ {
+		cellOffset, err := db.getCellContentOffset(page, header.cellPointerOffset(i))
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("cell %d: %v", i, err))
+			continue
+		}
+		if cellOffset < header.CellContentStart {
+			problems = append(problems, fmt.Sprintf("cell %d at offset %d is before the cell content start %d", i, cellOffset, header.CellContentStart))
+		}
+	}
+
+	// Each freeblock starts with the offset of the next one, 0 for the last, and its own size in bytes
+	previousEnd := header.CellContentStart
+	for offset := int32(header.FirstFreeblock); offset != 0; {
+		if offset < previousEnd || offset+4 > db.usableSize {
+			problems = append(problems, fmt.Sprintf("freeblock at offset %d is outside the free part of the cell content area", offset))
+			break
+		}
+		size := int32(binary.BigEndian.Uint16(page[offset+2:]))
+		if size < 4 || offset+size > db.usableSize {
+			problems = append(problems, fmt.Sprintf("freeblock at offset %d has size %d", offset, size))
+			break
+		}
+		previousEnd = offset + size
+		offset = int32(binary.BigEndian.Uint16(page[offset:]))
+	}
+	return problems
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// joinSource is one table of a join. Rows of the join are the full rows of every table one after another,
+// each laid out as readRowValues returns them, so a table's columns start at offset.
+type joinSource struct {
+	TableRef
+	rootPage   int32
+	columnDefs []string
+	layout     tableLayout
+	offset     int
+}
+
+// openJoinSources looks up every table of the FROM clause in sqlite_schema
+func (db *Database) openJoinSources(tableRefs []TableRef) ([]joinSource, error) {
+	var sources []joinSource
+	offset := 0
+	for _, tableRef := range tableRefs {
+		rootPage, createStatement, found, err := db.findTable(tableRef.Name)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("no such table: %s", tableRef.Name)
+		}
+		columnDefs := parseColumnDefs(createStatement)
+		sources = append(sources, joinSource{
+			TableRef:   tableRef,
+			rootPage:   rootPage,
+			columnDefs: columnDefs,
+			layout:     db.newTableLayout(createStatement),
+			offset:     offset,
+		})
+		offset += len(columnDefs) + 1 // readRowValues puts the rowid after the columns
+	}
+	return sources, nil
+}
+
+// readRows loads every row of the source's table, joins revisit them once per row of the other tables
+func (db *Database) readRows(source joinSource) (Rows, error) {
+	var rows Rows
+	_, err := db.scanTable(source.rootPage, source.layout, func(rowValues []Value) bool {
+		rows = append(rows, rowValues)
+		return true
+	})
+	return rows, err
+}
+
+// resolveJoinColumn returns the index of a column in a joined row, the name may be qualified with a table name or
+// alias. An unknown name or one that is ambiguous between tables gives -1.
+func resolveJoinColumn(sources []joinSource, colName string) int {
+	qualifier, column := splitQualifiedName(colName)
+	match := -1
+	for _, source := range sources {
+		if qualifier != "" && !strings.EqualFold(qualifier, source.Alias) {
+			continue
+		}
+		if idx := findColumnIndex(source.columnDefs, column); idx != -1 {
+			if match != -1 {
+				return -1
+			}
+			match = source.offset + idx
+		}
+	}
+	return match
+}
+
+// resolveJoinClause resolves the columns of a where clause or ON conditions against the joined row and sets their
+// type affinities
+func resolveJoinClause(sources []joinSource, whereClause WhereClause) WhereClause {
+	resolvedClause := resolveWhereClauseWith(whereClause, func(colName string) int {
+		return resolveJoinColumn(sources, colName)
+	})
+	for _, group := range resolvedClause {
+		for i := range group {
+			group[i].Affinity = joinColumnAffinity(sources, group[i].ColIdx)
+			group[i].ValueAffinity = joinColumnAffinity(sources, group[i].ValueColIdx)
+		}
+	}
+	return resolvedClause
+}
+
+// joinColumnAffinity returns the type affinity of a column of the joined row, the rowid after a table's columns is
+// an INTEGER
+func joinColumnAffinity(sources []joinSource, idx int) string {
+	for _, source := range sources {
+		if idx >= source.offset && idx < source.offset+len(source.columnDefs) {
+			return columnAffinity(source.columnDefs[idx-source.offset])
+		}
+		if idx == source.offset+len(source.columnDefs) {
+			return "INTEGER"
+		}
+	}
+	return ""
+}
+
+// resolveJoinColumnIndices maps the select list to joined row indices, * expands to the columns of every table and
+// table.* to the columns of that table
+func resolveJoinColumnIndices(sources []joinSource, colNames []string) []int {
+	var colIdxs []int
+	for _, colName := range colNames {
+		qualifier, column := splitQualifiedName(colName)
+		if column == "*" {
+			for _, source := range sources {
+				if qualifier != "" && !strings.EqualFold(qualifier, source.Alias) {
+					continue
+				}
+				for idx := range source.columnDefs {
+					colIdxs = append(colIdxs, source.offset+idx)
+				}
+			}
+			continue
+		}
+		if idx := resolveJoinColumn(sources, colName); idx != -1 {
+			colIdxs = append(colIdxs, idx)
+		}
+	}
+	return colIdxs
+}
+
+// hasJoinSource reports whether one of the joined tables is named or aliased alias
+func hasJoinSource(sources []joinSource, alias string) bool {
+	for _, source := range sources {
+		if strings.EqualFold(source.Alias, alias) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitQualifiedName splits table.column into its unquoted parts, the qualifier is empty for a bare column
+func splitQualifiedName(name string) (string, string) {
+	if dotIndex := strings.LastIndex(name, "."); dotIndex != -1 {
+		return unquoteIdentifier(name[:dotIndex]), unquoteIdentifier(name[dotIndex+1:])
+	}
+	return "", name
+}
+
+// QueryJoin runs a SELECT over the cartesian product of several tables, filtered by the where clause. It is a
+// plain nested loop over the rows of every table so it's only meant for small tables.
+func (db *Database) QueryJoin(tableRefs []TableRef, colNames []string, whereClause WhereClause, orderBy OrderBy, limit int, offset int) (Rows, error) {
+	sources, err := db.openJoinSources(tableRefs)
+	if err != nil {
+		return nil, err
+	}
+	resolve := func(colName string) int {
+		return resolveJoinColumn(sources, colName)
+	}
+	for _, colName := range colNames {
+		if qualifier, column := splitQualifiedName(colName); column != "*" && resolve(colName) == -1 {
+			return nil, fmt.Errorf("no such column: %s", colName)
+		} else if column == "*" && qualifier != "" && !hasJoinSource(sources, qualifier) {
+			return nil, fmt.Errorf("no such table: %s", qualifier)
+		}
+	}
+	colIdxs := resolveJoinColumnIndices(sources, colNames)
+	resolvedClause := resolveJoinClause(sources, whereClause)
+	orderColIdx := -1
+	if orderBy.Column != "" {
+		if orderColIdx = resolve(orderBy.Column); orderColIdx == -1 {
+			return nil, fmt.Errorf("no such column: %s", orderBy.Column)
+		}
+	}
+	if orderColIdx != -1 {
+		colIdxs = append(colIdxs, orderColIdx) // Sort key as an extra trailing column
+	}
+
+	tableRows := make([]Rows, len(sources))
+	for i, source := range sources {
+		rows, err := db.readRows(source)
+		if err != nil {
+			return nil, err
+		}
+		tableRows[i] = rows
+	}
+
+	// ON conditions are checked as soon as the table they belong to is added to the row. An equality with a column
+	// of an earlier table is a hash join: the table's rows are bucketed by the join column once and each combined row
+	// only visits the bucket with its own value instead of every row.
+	onConditions := make([][]WhereCondition, len(sources))
+	hashJoins := make([]*hashJoin, len(sources))
+	for i, source := range sources {
+		if len(source.On) == 0 {
+			continue
+		}
+		onConditions[i] = resolveJoinClause(sources, WhereClause{source.On})[0]
+		hashJoins[i] = newHashJoin(source, onConditions[i], tableRows[i])
+	}
+
+	var rows Rows
+	skipped := 0
+	var product func(depth int, combined []Value) bool
+	product = func(depth int, combined []Value) bool {
+		if depth == len(sources) {
+			if !matchesWhereClause(combined, resolvedClause) {
+				return true
+			}
+			if orderColIdx == -1 && skipped < offset {
+				skipped++ // With ORDER BY the rows are skipped after sorting instead
+				return true
+			}
+			rows = append(rows, projectRow(combined, colIdxs))
+			return orderColIdx != -1 || limit == -1 || len(rows) < limit
+		}
+		candidates := tableRows[depth]
+		if hashJoins[depth] != nil {
+			candidates = hashJoins[depth].probe(combined)
+		}
+		for _, rowValues := range candidates {
+			joined := append(combined[:len(combined):len(combined)], rowValues...)
+			if onConditions[depth] != nil && !matchesWhereConditions(joined, onConditions[depth]) {
+				continue
+			}
+			if !product(depth+1, joined) {
+				return false
+			}
+		}
+		return true
+	}
+	if limit != 0 {
+		product(0, nil)
+	}
+
+	if orderColIdx != -1 {
+		return sortRowsByTrailingKey(rows, orderBy.Descending, limit, offset), nil
+	}
+	return rows, nil
+}
+
+// hashJoin buckets a table's rows by the value of its join column, probeIdx is the column of the already joined
+// tables the bucket is looked up with
+type hashJoin struct {
+	buckets  map[string]Rows
+	probeIdx int
+}
+
+// newHashJoin builds the buckets for the first ON equality between a column of source and an earlier table, it
+// returns nil when there is none and every row has to be visited
+func newHashJoin(source joinSource, conditions []WhereCondition, rows Rows) *hashJoin {
+	isOwnColumn := func(idx int) bool {
+		return idx >= source.offset && idx <= source.offset+len(source.columnDefs)
+	}
+	for _, condition := range conditions {
+		if condition.Operator != "=" || condition.NoCase || condition.Negate || condition.ColIdx < 0 || condition.ValueColIdx < 0 {
+			continue
+		}
+		buildIdx, probeIdx := condition.ColIdx, condition.ValueColIdx
+		if !isOwnColumn(buildIdx) {
+			buildIdx, probeIdx = probeIdx, buildIdx
+		}
+		if !isOwnColumn(buildIdx) || probeIdx >= source.offset {
+			continue
+		}
+		buckets := make(map[string]Rows)
+		for _, rowValues := range rows {
+			value := rowValues[buildIdx-source.offset]
+			if value.IsNull() {
+				continue // NULL never equals anything
+			}
+			key := joinKey(value)
+			buckets[key] = append(buckets[key], rowValues)
+		}
+		return &hashJoin{buckets: buckets, probeIdx: probeIdx}
+	}
+	return nil
+}
+
+// probe returns the rows whose join column equals the value in the row joined so far
+func (h *hashJoin) probe(combined []Value) Rows {
+	value := combined[h.probeIdx]
+	if value.IsNull() {
+		return nil
+	}
+	return h.buckets[joinKey(value)]
+}
+
+// joinKey is the bucket of a value, numbers are normalised because compareTypedValues treats 1 and 1.0 as equal.
+// Reals keep every digit so that values which differ only past the 15 digits Value.String prints stay apart.
+func joinKey(value Value) string {
+	switch v := value.Data.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case int64:
+		return strconv.FormatFloat(float64(v), 'g', -1, 64)
+	}
+	s := value.String()
+	if number, err := strconv.ParseFloat(s, 64); err == nil {
+		return strconv.FormatFloat(number, 'g', -1, 64)
+	}
+	return s
+}
+
+// JoinColumnNames is ColumnNames for a join, a qualified column is named without its table like sqlite3 does
+func (db *Database) JoinColumnNames(tableRefs []TableRef, colNames []string, aliases []string) []string {
+	sources, _ := db.openJoinSources(tableRefs)
+	var names []string
+	for i, colName := range colNames {
+		qualifier, column := splitQualifiedName(colName)
+		if column != "*" {
+			if aliases[i] == colName {
+				names = append(names, column)
+			} else {
+				names = append(names, aliases[i])
+			}
+			continue
+		}
+		for _, source := range sources {
+			if qualifier != "" && !strings.EqualFold(qualifier, source.Alias) {
+				continue
+			}
+			for _, colDef := range source.columnDefs {
+				names = append(names, columnDefName(colDef))
+			}
+		}
+	}
+	return names
+}
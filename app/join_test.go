@@ -0,0 +1,66 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestColumnComparisonsKeepTheValueType(t *testing.T) {
+	// The real just above 0.3 is 0.1 + 0.2 at run time, it prints as 0.3 but isn't equal to it
+	nextAfter := math.Nextafter(0.3, 1)
+	b := newTestDB(t, 4096)
+	b.addTable("c", "CREATE TABLE c(id integer primary key, r1 real, r2 real, t text, n integer, b)",
+		testRow{1, []any{nil, 0.3, nextAfter, "5", 5, 5}},
+		testRow{2, []any{nil, 0.5, 0.5, "5.0", 6, "5"}},
+		testRow{3, []any{nil, 1e20, 1e20, "abc", 7, []byte{0x05}}},
+		testRow{4, []any{nil, nil, 2.5, "7", 7, 7.0}})
+	b.addTable("a", "CREATE TABLE a(id integer primary key, r real, t text, v)",
+		testRow{1, []any{nil, 0.3, "0.3", 0.3}},
+		testRow{2, []any{nil, nextAfter, "5", "5"}},
+		testRow{3, []any{nil, 0.5, "7", 7}})
+	db := b.open()
+
+	// Expected output is what sqlite3 prints for the same tables
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"SELECT count(*) FROM c WHERE r2 = r1", "2\n"},
+		{"SELECT id FROM c WHERE r2 > r1", "1\n"},
+		{"SELECT id FROM c WHERE NOT r2 = r1", "1\n"},
+		{"SELECT id FROM c WHERE t = n", "1\n4\n"}, // The text gets the INTEGER column's affinity
+		{"SELECT id FROM c WHERE b = n", "1\n4\n"}, // 7.0 equals 7
+		{"SELECT id FROM c WHERE b = t", ""},       // Neither column is numeric, so 5 isn't the text '5' and '5' isn't '5.0'
+		{"SELECT c.id, a.id FROM c JOIN a ON c.r2 = a.r", "1|2\n2|3\n"},
+		{"SELECT c.id, a.id FROM c, a WHERE c.r2 = a.r", "1|2\n2|3\n"},
+		{"SELECT c.id, a.id FROM c JOIN a ON c.n = a.t", "1|2\n3|3\n4|3\n"},
+		{"SELECT c.id, a.id FROM c JOIN a ON a.v = c.t", "1|2\n"},
+	}
+	for _, tt := range tests {
+		if got, code := runCaptured(t, db, tt.command); got != tt.want || code != exitSuccess {
+			t.Errorf("%q printed %q with exit code %d, want %q", tt.command, got, code, tt.want)
+		}
+	}
+}
+
+func TestOuterJoinsAreRejected(t *testing.T) {
+	db := applesDB(t)
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"SELECT a.name FROM apples a LEFT JOIN apples b ON a.id = b.id", "Error: LEFT JOIN is not supported\n"},
+		{"SELECT a.name FROM apples a left outer join apples b ON a.id = b.id", "Error: LEFT JOIN is not supported\n"},
+		{"SELECT a.name FROM apples a RIGHT JOIN apples b ON a.id = b.id", "Error: RIGHT JOIN is not supported\n"},
+		{"SELECT a.name FROM apples a FULL OUTER JOIN apples b ON a.id = b.id", "Error: FULL JOIN is not supported\n"},
+		{"SELECT a.name FROM apples a NATURAL JOIN apples b", "Error: NATURAL JOIN is not supported\n"},
+	}
+	for _, tt := range tests {
+		if got, code := runCapturedError(t, db, tt.command); got != tt.want || code != exitSQLError {
+			t.Errorf("%q reported %q with exit code %d, want %q", tt.command, got, code, tt.want)
+		}
+	}
+	if got, code := runCaptured(t, db, "SELECT a.name FROM apples a INNER JOIN apples b ON a.id = b.id WHERE b.id = 2"); got != "Fuji\n" || code != exitSuccess {
+		t.Errorf("an inner join printed %q with exit code %d, want Fuji", got, code)
+	}
+}
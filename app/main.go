@@ -1,1153 +1,673 @@
 package main
 
 import (
-	"bytes"
-	"encoding/binary"
+	"bufio"
 	"fmt"
-	"log"
-	"math"
+	"io"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
-	// Available if you need it!
 )
 
-type WhereCondition struct {
-	ColIdx int
-	Value  string
-}
+// Exit codes, anything non-zero is a failure
+const (
+	exitSuccess  = 0 // the command ran, even if it matched no rows
+	exitSQLError = 1 // the statement failed, e.g. an unknown table or an invalid LIMIT
+	exitUsage    = 2 // missing arguments or an unknown dot command
+	exitDatabase = 3 // the database file could not be opened or read
+)
 
-// HELPERS
-func readBytesAtOffset(file *os.File, offset int64, numBytes int) ([]byte, error) {
-	_, err := file.Seek(offset, 0)
+// Usage: your_program.sh sample.db .dbinfo
+func main() {
+	// Options come before the database path like with sqlite3, e.g. your_program.sh -json sample.db "SELECT ..."
+	settings := OutputSettings{Mode: "list", Separator: "|"}
+	verbose := false
+	args := os.Args[1:]
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		switch strings.TrimLeft(args[0], "-") {
+		case "json", "csv", "column", "list":
+			settings.Mode = strings.TrimLeft(args[0], "-")
+		case "header":
+			settings.Header = true
+		case "verbose":
+			verbose = true // Also list the internal sqlite_ tables
+		case "stats":
+			settings.Stats = true
+		case "separator":
+			if len(args) < 2 {
+				fmt.Fprintln(os.Stderr, "Error: missing argument to -separator")
+				os.Exit(exitUsage)
+			}
+			// Accept the same escapes as sqlite3 so a tab can be passed as -separator '\t'
+			settings.Separator = strings.NewReplacer(`\t`, "\t", `\n`, "\n", `\\`, `\`).Replace(args[1])
+			args = args[1:]
+		case "bool":
+			// Can be repeated, the named result column shows 0 and 1 as false and true
+			if len(args) < 2 {
+				fmt.Fprintln(os.Stderr, "Error: missing argument to -bool")
+				os.Exit(exitUsage)
+			}
+			if settings.BoolColumns == nil {
+				settings.BoolColumns = make(map[string]bool)
+			}
+			settings.BoolColumns[strings.ToLower(args[1])] = true
+			args = args[1:]
+		default:
+			fmt.Fprintf(os.Stderr, "Error: unknown option: %s\n", args[0])
+			os.Exit(exitUsage)
+		}
+		args = args[1:]
+	}
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: your_program.sh [-json|-csv|-column|-list] [-header] [-separator <sep>] [-bool <column>] [-stats] [-verbose] <database> [<command>|-]")
+		os.Exit(exitUsage)
+	}
+	databaseFilePath := args[0]
+
+	db, err := OpenDatabase(databaseFilePath)
 	if err != nil {
-		return nil, fmt.Errorf("error seeking to offset %d: %v", offset, err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitDatabase)
 	}
 
-	buffer := make([]byte, numBytes) // array of bytes
-
-	n, err := file.Read(buffer)
-	if err != nil {
-		return nil, fmt.Errorf("error reading %d bytes at offset %d: %v", numBytes, offset, err)
+	// Without a command read them from stdin until .exit or EOF, - runs stdin as a script of ;-separated statements,
+	// otherwise run the one from argv
+	if len(args) == 1 {
+		runREPL(db, &settings, verbose)
+		db.Close()
+		return
 	}
-	if n != numBytes {
-		return nil, fmt.Errorf("expected to read %d bytes, but read %d", numBytes, n)
+	if args[1] == "-" {
+		exitCode := runScript(db, os.Stdin, &settings, verbose)
+		db.Close()
+		os.Exit(exitCode)
 	}
-
-	return buffer, nil
+	exitCode := runCommand(db, args[1], args[2:], &settings, verbose)
+	db.Close()
+	os.Exit(exitCode)
 }
 
-func readVarint(data []byte, index int) (value int64, bytesRead int32) {
-	if index >= len(data) {
-		return 0, 0
+// runREPL runs one command per line of stdin, errors are reported without stopping. The prompt is only shown when
+// stdin is a terminal so piped input gives clean output.
+func runREPL(db *Database, settings *OutputSettings, verbose bool) {
+	interactive := false
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		interactive = true
 	}
-
-	maxBytes := 9
-	if index+maxBytes > len(data) {
-		maxBytes = len(data) - index
-	}
-
-	value = 0
-	bytesRead = 0
-
-	for i := 0; i < maxBytes && i < 9; i++ {
-		bytesRead++
-
-		// For the first 8 bytes, we only use the lower 7 bits
-		if i < 8 {
-			// Shift the existing value left by 7 bits and add the lower 7 bits of the current byte
-			value = (value << 7) | int64(data[index+i]&0x7F)
-
-			// If the high bit is not set, we've reached the end of the varint
-			if (data[index+i] & 0x80) == 0 {
-				return value, bytesRead
-			}
-		} else {
-			// For the 9th byte, we use all 8 bits
-			value = (value << 8) | int64(data[index+i])
-			return value, bytesRead
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		if interactive {
+			fmt.Print("sqlite> ")
 		}
-	}
-
-	// If we've read 9 bytes or reached the end of the data, return what we have
-	return value, bytesRead
-}
-
-func getSerialTypeSize(serialType int64) int {
-	switch {
-	case serialType == 0, serialType == 8, serialType == 9:
-		return 0
-	case serialType == 1:
-		return 1
-	case serialType == 2:
-		return 2
-	case serialType == 3:
-		return 3
-	case serialType == 4:
-		return 4
-	case serialType == 5:
-		return 6
-	case serialType == 6, serialType == 7:
-		return 8
-	case serialType >= 12 && serialType%2 == 0: // BLOB
-		return int((serialType - 12) / 2)
-	case serialType >= 13 && serialType%2 == 1: // String
-		return int((serialType - 13) / 2)
-	}
-	return 0
-}
-
-func processSerialType(serialType int64, value []byte) string {
-	var strValue string
-
-	switch serialType {
-	case 0: // NULL
-		strValue = "NULL"
-	case 1: // 8-bit twos-complement integer
-		strValue = fmt.Sprintf("%d", int8(value[0]))
-	case 2: // 16-bit twos-complement integer (big-endian)
-		num := int16(binary.BigEndian.Uint16(value))
-		strValue = fmt.Sprintf("%d", num)
-	case 3: // 24-bit twos-complement integer (big-endian)
-		var extendedBytes []byte
-		if value[0]&0x80 != 0 { // Check if the sign bit is set
-			extendedBytes = append([]byte{0xFF}, value[:3]...)
-		} else {
-			extendedBytes = append([]byte{0x00}, value[:3]...)
+		if !scanner.Scan() {
+			break
 		}
-		num := int32(binary.BigEndian.Uint32(extendedBytes))
-		strValue = fmt.Sprintf("%d", num)
-	case 4: // 32-bit twos-complement integer (big-endian)
-		num := int32(binary.BigEndian.Uint32(value))
-		strValue = fmt.Sprintf("%d", num)
-	case 5: // 48-bit twos-complement integer (big-endian)
-		var extendedBytes []byte
-		if value[0]&0x80 != 0 {
-			extendedBytes = append([]byte{0xFF, 0xFF}, value[:6]...)
-		} else {
-			extendedBytes = append([]byte{0x00, 0x00}, value[:6]...)
+		command := strings.TrimSpace(scanner.Text())
+		command = strings.TrimSpace(strings.TrimSuffix(command, ";"))
+		if command == "" {
+			continue
 		}
-		num := int64(binary.BigEndian.Uint64(extendedBytes))
-		strValue = fmt.Sprintf("%d", num)
-	case 6: // 64-bit twos-complement integer (big-endian)
-		num := int64(binary.BigEndian.Uint64(value))
-		strValue = fmt.Sprintf("%d", num)
-	case 7: // 64-bit IEEE 754-2008 floating point (big-endian)
-		bits := binary.BigEndian.Uint64(value)
-		num := math.Float64frombits(bits)
-		strValue = fmt.Sprintf("%f", num)
-	case 8: // Integer 0
-		strValue = "0"
-	case 9: // Integer 1
-		strValue = "1"
-	case 10, 11: // Reserved for internal use
-		strValue = fmt.Sprintf("Reserved(%d)", serialType)
-	default:
-		if serialType >= 12 && serialType%2 == 0 { // BLOB (N-12)/2 bytes
-			blobLen := (serialType - 12) / 2
-			if int64(len(value)) >= blobLen {
-				strValue = fmt.Sprintf("BLOB(%d bytes)", blobLen)
-				// Optionally: strValue = hex.EncodeToString(value[:blobLen]) for hex representation
-			} else {
-				strValue = "Invalid BLOB"
-			}
-		} else if serialType >= 13 && serialType%2 == 1 { // String (N-13)/2 bytes
-			strLen := (serialType - 13) / 2
-			if int64(len(value)) >= strLen {
-				strValue = string(value[:strLen]) // No null terminator
-			} else {
-				strValue = "Invalid String"
-			}
-		} else {
-			strValue = "Unknown Type"
+		if command == ".exit" || command == ".quit" {
+			break
 		}
+		runCommand(db, command, nil, settings, verbose)
 	}
-
-	return strValue
-}
-
-func getCellCount(databaseFile *os.File, pageOffset int32) uint16 {
-	data, err := readBytesAtOffset(databaseFile, int64(pageOffset+3), 2)
-	if err != nil {
-		return 0
-	}
-	cellCount := binary.BigEndian.Uint16(data)
-	return cellCount
-}
-
-func getRightmostChildPageNumber(databaseFile *os.File, pageOffset int32) int32 {
-	data, err := readBytesAtOffset(databaseFile, int64(pageOffset+8), 4)
-	if err != nil {
-		return 0
-	}
-	return int32(binary.BigEndian.Uint32(data))
-}
-
-func getCellContentOffset(databaseFile *os.File, cellPointerOffset int32) int32 {
-	data, err := readBytesAtOffset(databaseFile, int64(cellPointerOffset), 2)
-	if err != nil {
-		return 0
-	}
-	return int32(binary.BigEndian.Uint16(data)) // offset in the cell array is relative to 0
-}
-
-func processLeafCellRecord(databaseFile *os.File, cellContentOffset int32) ([]byte, []int64, int64, int64) {
-	// [varint] read size of the record
-	data, err := readBytesAtOffset(databaseFile, int64(cellContentOffset), 9)
-	if err != nil {
-		return nil, nil, 0, 0
-	}
-	recordSize, bytesReadRecordSize := readVarint(data, 0)
-	// [varint] read size of rowid
-	data, err = readBytesAtOffset(databaseFile, int64(cellContentOffset+bytesReadRecordSize), 9)
-	if err != nil {
-		return nil, nil, 0, 0
-	}
-	rowId, bytesReadRowId := readVarint(data, 0)
-
-	// Read the record data (with header)
-	recordOffset := cellContentOffset + bytesReadRecordSize + bytesReadRowId
-	data, err = readBytesAtOffset(databaseFile, int64(recordOffset), int(recordSize))
-	if err != nil {
-		return nil, nil, 0, 0
-	}
-
-	// [varint] Parse record header
-	headerSize, bytesReadHeader := readVarint(data, 0)
-	headerOffset := bytesReadHeader
-	bodyOffset := int64(headerSize) // Body starts after the header
-	// Parse serial types
-	var serialTypes []int64
-	for int32(headerOffset) < int32(headerSize) {
-		serialType, bytesRead := readVarint(data, int(headerOffset))
-		headerOffset += bytesRead // TODO: This may potentially make headerOffset + bytesRead > headerSize for last iteration. By right after everything headerOffset == headerSize
-		serialTypes = append(serialTypes, serialType)
+	if interactive {
+		fmt.Println()
 	}
-
-	return data, serialTypes, bodyOffset, rowId
 }
 
-func processIndexRecord(databaseFile *os.File, cellContentOffset int32) ([]byte, []int64, int64) {
-	// [varint] read size of the record
-	data, err := readBytesAtOffset(databaseFile, int64(cellContentOffset), 9)
-	if err != nil {
-		return nil, nil, 0
-	}
-	recordSize, bytesReadRecordSize := readVarint(data, 0)
-	// Read the record data (with header)
-	recordOffset := cellContentOffset + bytesReadRecordSize
-	data, err = readBytesAtOffset(databaseFile, int64(recordOffset), int(recordSize))
-	if err != nil {
-		return nil, nil, 0
-	}
-
-	// [varint] Parse record header
-	headerSize, bytesReadHeader := readVarint(data, 0)
-	headerOffset := bytesReadHeader
-	bodyOffset := int64(headerSize) // Body starts after the header
-	// Parse serial types
-	var serialTypes []int64
-	for int32(headerOffset) < int32(headerSize) {
-		serialType, bytesRead := readVarint(data, int(headerOffset))
-		headerOffset += bytesRead // TODO: This may potentially make headerOffset + bytesRead > headerSize for last iteration. By right after everything headerOffset == headerSize
-		serialTypes = append(serialTypes, serialType)
-	}
-
-	return data, serialTypes, bodyOffset
-}
-
-// PROCESS
-func getTablesNamesInBTree(databaseFile *os.File, pageNumber int32, pageSize int32) []string {
-	var tables []string
-	const headerSize int32 = 100
-	var pageOffset int32 = (pageNumber - 1) * pageSize
-	if pageNumber == 1 {
-		pageOffset += headerSize
-	}
-
-	data, err := readBytesAtOffset(databaseFile, int64(pageOffset), 1)
+// runScript runs every statement and dot command read from r in turn. A failing one is reported and the rest still
+// run, the exit code is that of the last failure.
+func runScript(db *Database, r io.Reader, settings *OutputSettings, verbose bool) int {
+	script, err := io.ReadAll(r)
 	if err != nil {
-		return tables
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
 	}
-
-	switch data[0] {
-	case 0x0D: // Leaf page
-		cellCount := getCellCount(databaseFile, pageOffset)
-		// Task 2: Read table names
-
-		// loop through cell count
-		for i := int32(0); i < int32(cellCount); i++ {
-			cellPointerOffset := pageOffset + 8 + (i * 2)
-			cellContentOffset := getCellContentOffset(databaseFile, cellPointerOffset) // offset in the cell array is relative to the start of page
-			if pageNumber != 1 {                                                       // Only add if not first page since for the first page you don't want to offset 100 since its not start
-				cellContentOffset += pageOffset
-			}
-
-			data, serialTypes, bodyOffset, _ := processLeafCellRecord(databaseFile, cellContentOffset)
-
-			for colIdx, serialType := range serialTypes {
-				size := getSerialTypeSize(serialType)
-				value := data[bodyOffset : bodyOffset+int64(size)]
-
-				strValue := processSerialType(serialType, value)
-				if colIdx == 2 { // tbl_name column
-					if serialType >= 13 && serialType%2 == 1 {
-						tables = append(tables, strValue)
-					}
-				}
-
-				bodyOffset += int64(size)
-			}
-
+	exitCode := exitSuccess
+	for _, command := range splitScript(string(script)) {
+		if command == ".exit" || command == ".quit" {
+			break
 		}
-
-		// return tables
-		return tables
-
-	case 0x05: // Interior page
-		cellCount := getCellCount(databaseFile, pageOffset)
-
-		for i := int32(0); i < int32(cellCount); i++ {
-			cellPointerOffset := pageOffset + 12 + (i * 2)
-			cellContentOffset := getCellContentOffset(databaseFile, cellPointerOffset) // offset in the cell array is relative to the start of page
-			if pageNumber != 1 {                                                       // Only add if not first page since for the first page you don't want to offset 100 since its not start
-				cellContentOffset += pageOffset
-			}
-
-			data, err = readBytesAtOffset(databaseFile, int64(cellContentOffset), 4)
-			if err != nil {
-				continue
-			}
-			leftChildPageNumber := int32(binary.BigEndian.Uint32(data))
-			tempNames := getTablesNamesInBTree(databaseFile, leftChildPageNumber, pageSize)
-			tables = append(tables, tempNames...)
-
+		if code := runCommand(db, command, nil, settings, verbose); code != exitSuccess {
+			exitCode = code
 		}
-
-		// Rightmost pointer
-		rightChildPageNumber := getRightmostChildPageNumber(databaseFile, pageOffset)
-		tempNames := getTablesNamesInBTree(databaseFile, rightChildPageNumber, pageSize)
-		tables = append(tables, tempNames...)
 	}
-
-	return tables
+	return exitCode
 }
 
-func getCountInATable(databaseFile *os.File, pageNumber int32, pageSize int32, tableName string) int {
-	var count int = 0
-	const headerSize int32 = 100
-	var pageOffset int32 = (pageNumber - 1) * pageSize
-	if pageNumber == 1 {
-		pageOffset += headerSize
-	}
-
-	data, err := readBytesAtOffset(databaseFile, int64(pageOffset), 1)
-	if err != nil {
-		return count
+// runCommand runs a dot command or SQL statement and returns the exit code it would end the program with. Extra
+// arguments are passed on to dot commands, settings can be changed by .mode for the commands that follow.
+func runCommand(db *Database, command string, extraArgs []string, settings *OutputSettings, verbose bool) int {
+	// Dot commands can take arguments, either inside the command string or as extra argv entries
+	commandName := command
+	var commandArgs []string
+	if fields := strings.Fields(command); len(fields) > 0 && strings.HasPrefix(fields[0], ".") {
+		commandName = fields[0]
+		commandArgs = append(fields[1:], extraArgs...)
 	}
 
-	switch data[0] {
-	case 0x0D: // Leaf page
-		cellCount := getCellCount(databaseFile, pageOffset)
-		// Task 3: Read number of rows in table
-
-		// loop through cell count
-		var foundTable bool = false
-		for i := int32(0); i < int32(cellCount); i++ {
-			cellPointerOffset := pageOffset + 8 + (i * 2)
-			cellContentOffset := getCellContentOffset(databaseFile, cellPointerOffset) // offset in the cell array is relative to the start of page
-			if pageNumber != 1 {                                                       // Only add if not first page since for the first page you don't want to offset 100 since its not start
-				cellContentOffset += pageOffset
-			}
-
-			data, serialTypes, bodyOffset, _ := processLeafCellRecord(databaseFile, cellContentOffset)
-
-			for colIdx, serialType := range serialTypes {
-				size := getSerialTypeSize(serialType)
-				value := data[bodyOffset : bodyOffset+int64(size)]
-
-				strValue := processSerialType(serialType, value)
-
-				if colIdx == 2 { // tbl_name column
-					if serialType >= 13 && serialType%2 == 1 {
-						if strValue == tableName {
-							foundTable = true
-						}
-					}
-				}
-				if colIdx == 3 && foundTable {
-					// get root page
-					num, _ := strconv.Atoi(strValue)
-					count := countRecordsInBTree(databaseFile, int32(num), pageSize)
-					return count
-				}
+	switch commandName {
+	case ".dbinfo":
+		fmt.Fprintln(os.Stderr, "Logs from your program will appear here!")
 
-				bodyOffset += int64(size)
-			}
+		// Task 1: Getting page size and number of tables
+		fmt.Printf("database page size: %v\n", db.PageSize())
+		tableCount, err := db.TableCount()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitDatabase
+		}
+		fmt.Printf("number of tables: %v\n", tableCount)
+		fmt.Printf("database page count: %v\n", db.PageCount())
+		fmt.Printf("file change counter: %v\n", db.FileChangeCounter())
+		fmt.Printf("freelist page count: %v\n", db.FreelistPageCount())
+		fmt.Printf("schema cookie: %v\n", db.SchemaCookie())
+		fmt.Printf("schema format: %v\n", db.SchemaFormat())
+		fmt.Printf("text encoding: %v\n", db.TextEncoding())
+
+	case ".version":
+		// Which library and file format wrote the file, laid out like the version lines of sqlite3's .dbinfo
+		writeVersion, readVersion := db.FileFormatVersions()
+		fmt.Printf("write format: %v\n", writeVersion)
+		fmt.Printf("read format: %v\n", readVersion)
+		fmt.Printf("software version: %v (%v)\n", db.SoftwareVersion(), db.sqliteVersion())
 
+	case ".tables":
+		// Task 2: Get names of tables
+		tableNames, err := db.Tables(verbose)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitDatabase
 		}
 
-		return 0
-
-	case 0x05: // Interior page
-		cellCount := getCellCount(databaseFile, pageOffset)
-
-		for i := int32(0); i < int32(cellCount); i++ {
-			cellPointerOffset := pageOffset + 12 + (i * 2)
-			cellContentOffset := getCellContentOffset(databaseFile, cellPointerOffset) // offset in the cell array is relative to the start of page
-			if pageNumber != 1 {                                                       // Only add if not first page since for the first page you don't want to offset 100 since its not start
-				cellContentOffset += pageOffset
-			}
-
-			data, err = readBytesAtOffset(databaseFile, int64(cellContentOffset), 4)
-			if err != nil {
-				continue
+		for i, name := range tableNames {
+			if i != len(tableNames)-1 {
+				fmt.Printf("%s", name+" ")
+			} else {
+				fmt.Print(name)
 			}
-			leftChildPageNumber := int32(binary.BigEndian.Uint32(data))
-			count = count + getCountInATable(databaseFile, leftChildPageNumber, pageSize, tableName)
-
 		}
+		fmt.Println() // End the line so a REPL prompt doesn't follow on it
 
-		// Rightmost pointer
-		rightChildPageNumber := getRightmostChildPageNumber(databaseFile, pageOffset)
-		count = count + getCountInATable(databaseFile, rightChildPageNumber, pageSize, tableName)
-		return count
-	}
-
-	return 0
-}
-
-func getColumnDataHelper(databaseFile *os.File, pageNumber int32, pageSize int32, colIdx []int, whereCondition WhereCondition) []string {
-	var columnData []string
-	const headerSize int32 = 100
-	var pageOffset int32 = (pageNumber - 1) * pageSize
-	if pageNumber == 1 {
-		pageOffset += headerSize
-	}
-
-	data, err := readBytesAtOffset(databaseFile, int64(pageOffset), 1)
-	if err != nil {
-		return columnData
-	}
-
-	switch data[0] {
-	case 0x0D: // Leaf page
-		cellCount := getCellCount(databaseFile, pageOffset)
-		// loop through cell count
-		for i := int32(0); i < int32(cellCount); i++ {
-			cellPointerOffset := pageOffset + 8 + (i * 2)
-			cellContentOffset := getCellContentOffset(databaseFile, cellPointerOffset) // offset in the cell array is relative to the start of page
-			if pageNumber != 1 {                                                       // Only add if not first page since for the first page you don't want to offset 100 since its not start
-				cellContentOffset += pageOffset
-			}
-
-			data, serialTypes, bodyOffset, rowId := processLeafCellRecord(databaseFile, cellContentOffset)
-			var rowValues []string
-			var dataForCol string = ""
-			var isWhereConditionMet = true
-			for i, serialType := range serialTypes {
-				size := getSerialTypeSize(serialType)
-				value := data[bodyOffset : bodyOffset+int64(size)]
-				strValue := processSerialType(serialType, value)
-				rowValues = append(rowValues, strValue)
-				bodyOffset += int64(size)
-				if whereCondition.ColIdx != -1 && i == whereCondition.ColIdx && strValue != whereCondition.Value { // -1 is a marker for no where condition
-					// If the row condition does not meet the where condition, break
-					isWhereConditionMet = false
-					break
-				}
-			}
-			rowValues[0] = strconv.FormatInt(rowId, 10)
-			if isWhereConditionMet {
-				for i, idx := range colIdx {
-					if idx >= 0 && idx <= len(rowValues) { // Check valid table indices excluding id
-						if i > 0 {
-							dataForCol += "|"
-						}
-						dataForCol += rowValues[idx]
-					}
-				}
-
-				if dataForCol != "" {
-					columnData = append(columnData, dataForCol)
-				}
-			}
+	case ".indexes":
+		indexNames, err := db.Indexes()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitDatabase
 		}
+		fmt.Println(strings.Join(indexNames, " "))
 
-		return columnData
-
-	case 0x05: // Interior page
-		cellCount := getCellCount(databaseFile, pageOffset)
-
-		for i := int32(0); i < int32(cellCount); i++ {
-			cellPointerOffset := pageOffset + 12 + (i * 2)
-			cellContentOffset := getCellContentOffset(databaseFile, cellPointerOffset) // offset in the cell array is relative to the start of page
-			if pageNumber != 1 {                                                       // Only add if not first page since for the first page you don't want to offset 100 since its not start
-				cellContentOffset += pageOffset
-			}
-			data, err = readBytesAtOffset(databaseFile, int64(cellContentOffset), 4)
-			if err != nil {
-				continue
-			}
-			leftChildPageNumber := int32(binary.BigEndian.Uint32(data))
-			tempData := getColumnDataHelper(databaseFile, leftChildPageNumber, pageSize, colIdx, whereCondition)
-			columnData = append(columnData, tempData...)
+	case ".schema":
+		// Optional table name to only show that table and its indexes
+		tableName := ""
+		if len(commandArgs) > 0 {
+			tableName = commandArgs[0]
 		}
-
-		// Rightmost pointer
-		rightChildPageNumber := getRightmostChildPageNumber(databaseFile, pageOffset)
-		tempData := getColumnDataHelper(databaseFile, rightChildPageNumber, pageSize, colIdx, whereCondition)
-		columnData = append(columnData, tempData...)
-		return columnData
-	}
-
-	return columnData
-}
-
-func readDataFromMultipleColumns(databaseFile *os.File, pageNumber int32, pageSize int32, tableName string, colNames []string, rawWhereConditions []string) []string {
-	var columnData []string
-	const headerSize int32 = 100
-	var pageOffset int32 = (pageNumber - 1) * pageSize
-	if pageNumber == 1 {
-		pageOffset += headerSize
-	}
-
-	data, err := readBytesAtOffset(databaseFile, int64(pageOffset), 1)
-	if err != nil {
-		return columnData
-	}
-
-	switch data[0] {
-	case 0x0D: // Leaf page
-		cellCount := getCellCount(databaseFile, pageOffset)
-
-		// loop through cell count
-		rootPage := 0
-		createStatement := ""
-		for i := int32(0); i < int32(cellCount); i++ {
-			cellPointerOffset := pageOffset + 8 + (i * 2)
-			cellContentOffset := getCellContentOffset(databaseFile, cellPointerOffset) // offset in the cell array is relative to the start of page
-			if pageNumber != 1 {                                                       // Only add if not first page since for the first page you don't want to offset 100 since its not
-				cellContentOffset += pageOffset
-			}
-
-			data, serialTypes, bodyOffset, _ := processLeafCellRecord(databaseFile, cellContentOffset)
-			var recordValues []string
-			for _, serialType := range serialTypes {
-				size := getSerialTypeSize(serialType)
-				value := data[bodyOffset : bodyOffset+int64(size)]
-				strValue := processSerialType(serialType, value)
-				recordValues = append(recordValues, strValue)
-				bodyOffset += int64(size)
-			}
-			if len(recordValues) >= 5 && recordValues[0] == "table" && recordValues[2] == tableName {
-				num, _ := strconv.Atoi(recordValues[3])
-				rootPage = num
-				createStatement = recordValues[4]
-				break
-			}
+		statements, err := db.Schema(tableName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitDatabase
 		}
-		// Unpack where conditions
-		whereCol, whereValue := "", ""
-		if len(rawWhereConditions) != 0 {
-			whereCol, whereValue = rawWhereConditions[0], strings.Trim(strings.Join(rawWhereConditions[2:], " "), "'")
+		for _, statement := range statements {
+			fmt.Println(statement + ";")
 		}
-		var whereCondition WhereCondition = WhereCondition{ColIdx: -1, Value: ""}
 
-		// Get order of columnName in table
-		openParenIndex := strings.Index(createStatement, "(")
-		closeParenIndex := strings.LastIndex(createStatement, ")")
-		columnsPart := createStatement[openParenIndex+1 : closeParenIndex]
-		columnDefs := strings.Split(columnsPart, ",")
-		var colIdxs []int
-		for _, colName := range colNames {
-			for idx, colDef := range columnDefs {
-				colDef = strings.TrimSpace(colDef)
-				words := strings.Fields(colDef)
-				if len(words) > 0 && words[0] == colName {
-					colIdxs = append(colIdxs, idx)
-					break
-				}
-			}
+	case ".freelist":
+		// Free pages left behind by deletes, listed by the trunk page that tracks them
+		trunks, err := db.Freelist()
+		leafCount := 0
+		for _, trunk := range trunks {
+			leafCount += len(trunk.LeafPages)
 		}
-		for idx, colDef := range columnDefs {
-			colDef = strings.TrimSpace(colDef)
-			words := strings.Fields(colDef)
-			if words[0] == whereCol {
-				whereCondition = WhereCondition{ColIdx: idx, Value: whereValue}
-				break
-			}
+		fmt.Printf("freelist pages: %v\n", db.FreelistPageCount())
+		fmt.Printf("trunk pages: %v\n", len(trunks))
+		fmt.Printf("leaf pages: %v\n", leafCount)
+		for _, trunk := range trunks {
+			fmt.Printf("trunk %v: %v leaf pages %v\n", trunk.PageNumber, len(trunk.LeafPages), trunk.LeafPages)
 		}
-
-		// With the columnName order and rootpage, we can use them to find the column data
-		columnData = getColumnDataHelper(databaseFile, int32(rootPage), pageSize, colIdxs, whereCondition)
-
-		return columnData
-
-	case 0x05: // Interior page
-		cellCount := getCellCount(databaseFile, pageOffset)
-
-		for i := int32(0); i < int32(cellCount); i++ {
-			cellPointerOffset := pageOffset + 12 + (i * 2)
-			cellContentOffset := getCellContentOffset(databaseFile, cellPointerOffset) // offset in the cell array is relative to the start of page
-			if pageNumber != 1 {                                                       // Only add if not first page since for the first page you don't want to offset 100 since its not start
-				cellContentOffset += pageOffset
-			}
-
-			data, err = readBytesAtOffset(databaseFile, int64(cellContentOffset), 4)
-			if err != nil {
-				continue
-			}
-			leftChildPageNumber := int32(binary.BigEndian.Uint32(data))
-			tempData := readDataFromMultipleColumns(databaseFile, leftChildPageNumber, pageSize, tableName, colNames, rawWhereConditions)
-			columnData = append(columnData, tempData...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitDatabase
 		}
 
-		// Rightmost pointer
-		rightChildPageNumber := getRightmostChildPageNumber(databaseFile, pageOffset)
-		tempData := readDataFromMultipleColumns(databaseFile, rightChildPageNumber, pageSize, tableName, colNames, rawWhereConditions)
-		columnData = append(columnData, tempData...)
-		return columnData
-	}
-
-	return columnData
-}
-
-func countRecordsInBTree(databaseFile *os.File, pageNumber int32, pageSize int32) int {
-	numTables := 0
-	const headerSize int32 = 100
-	var pageOffset int32 = (pageNumber - 1) * pageSize
-	if pageNumber == 1 {
-		pageOffset += headerSize
-	}
-
-	data, err := readBytesAtOffset(databaseFile, int64(pageOffset), 1)
-	if err != nil {
-		return 0 // Consider proper error handling
-	}
-
-	switch data[0] {
-	case 0x0D: // Leaf page
-		cellCount := getCellCount(databaseFile, pageOffset)
-		numTables += int(cellCount)
-
-	case 0x05: // Interior page
-		cellCount := getCellCount(databaseFile, pageOffset)
-
-		for i := int32(0); i < int32(cellCount); i++ {
-			cellPointerOffset := pageOffset + 12 + (i * 2)
-			cellContentOffset := getCellContentOffset(databaseFile, cellPointerOffset) // offset in the cell array is relative to the start of page
-			if pageNumber != 1 {                                                       // Only add if not first page since for the first page you don't want to offset 100 since its not start
-				cellContentOffset += pageOffset
-			}
-
-			data, err = readBytesAtOffset(databaseFile, int64(cellContentOffset), 4)
-			if err != nil {
-				continue
-			}
-			leftChildPageNumber := int32(binary.BigEndian.Uint32(data))
-			numTables += countRecordsInBTree(databaseFile, leftChildPageNumber, pageSize)
+	case ".integrity":
+		// A lightweight integrity check of the page layouts, prints ok like sqlite3's PRAGMA integrity_check
+		problems, err := db.IntegrityCheck()
+		for _, problem := range problems {
+			fmt.Println(problem)
 		}
-
-		// Rightmost pointer
-		rightChildPageNumber := getRightmostChildPageNumber(databaseFile, pageOffset)
-		numTables += countRecordsInBTree(databaseFile, rightChildPageNumber, pageSize)
-	}
-
-	return numTables
-}
-
-func getRowIdsFromIndexTreeHelper(databaseFile *os.File, pageNumber int32, pageSize int32, colValue string) []string {
-	var rowIds []string
-	const headerSize int32 = 100
-	var pageOffset int32 = (pageNumber - 1) * pageSize
-	if pageNumber == 1 {
-		pageOffset += headerSize
-	}
-
-	data, err := readBytesAtOffset(databaseFile, int64(pageOffset), 1)
-	if err != nil {
-		return rowIds
-	}
-
-	switch data[0] {
-	case 0x0a: // Leaf page
-		cellCount := getCellCount(databaseFile, pageOffset)
-		// loop through cell count
-		for i := int32(0); i < int32(cellCount); i++ {
-			cellPointerOffset := pageOffset + 8 + (i * 2)
-			cellContentOffset := getCellContentOffset(databaseFile, cellPointerOffset) // offset in the cell array is relative to the start of page
-			if pageNumber != 1 {                                                       // Only add if not first page since for the first page you don't want to offset 100 since its not start
-				cellContentOffset += pageOffset
-			}
-			data, serialTypes, bodyOffset := processIndexRecord(databaseFile, cellContentOffset) // Don't have rowid
-			var recordValues []string
-			for _, serialType := range serialTypes {
-				size := getSerialTypeSize(serialType)
-				value := data[bodyOffset : bodyOffset+int64(size)]
-				strValue := processSerialType(serialType, value)
-				recordValues = append(recordValues, strValue)
-				bodyOffset += int64(size)
-			}
-			if recordValues[0] == colValue {
-				rowIds = append(rowIds, recordValues[1])
-			}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitDatabase
 		}
-
-		return rowIds
-
-	case 0x02: // Interior page
-		cellCount := getCellCount(databaseFile, pageOffset)
-
-		for i := int32(0); i < int32(cellCount); i++ {
-			cellPointerOffset := pageOffset + 12 + (i * 2)
-			cellContentOffset := getCellContentOffset(databaseFile, cellPointerOffset) // offset in the cell array is relative to the start of page
-			if pageNumber != 1 {                                                       // Only add if not first page since for the first page you don't want to offset 100 since its not start
-				cellContentOffset += pageOffset
-			}
-			data, err = readBytesAtOffset(databaseFile, int64(cellContentOffset), 4)
-			if err != nil {
-				continue
-			}
-			leftChildPageNumber := int32(binary.BigEndian.Uint32(data))
-			// read varint with the total number of bytes for payload
-			data, serialTypes, bodyOffset := processIndexRecord(databaseFile, cellContentOffset+4)
-			var recordValues []string
-			for _, serialType := range serialTypes {
-				size := getSerialTypeSize(serialType)
-				value := data[bodyOffset : bodyOffset+int64(size)]
-				strValue := processSerialType(serialType, value)
-				recordValues = append(recordValues, strValue)
-				bodyOffset += int64(size)
-			}
-			if colValue < recordValues[0] {
-				tempData := getRowIdsFromIndexTreeHelper(databaseFile, leftChildPageNumber, pageSize, colValue)
-				rowIds = append(rowIds, tempData...)
-				return rowIds
-			} else if colValue == recordValues[0] {
-				rowIds = append(rowIds, recordValues[1]) // stores payload too, seems like not in leaf nodes
-				tempData := getRowIdsFromIndexTreeHelper(databaseFile, leftChildPageNumber, pageSize, colValue)
-				rowIds = append(rowIds, tempData...)
-			}
+		if len(problems) == 0 {
+			fmt.Println("ok")
 		}
 
-		// Rightmost pointer
-		rightChildPageNumber := getRightmostChildPageNumber(databaseFile, pageOffset)
-		tempData := getRowIdsFromIndexTreeHelper(databaseFile, rightChildPageNumber, pageSize, colValue)
-		rowIds = append(rowIds, tempData...)
-		return rowIds
-	}
-
-	return rowIds
-}
-
-func getRowIdsFromIndexTree(databaseFile *os.File, pageNumber int32, pageSize int32, tableName string, rawWhereConditions []string) []string {
-	var rowIds []string
-	const headerSize int32 = 100
-	var pageOffset int32 = (pageNumber - 1) * pageSize
-	if pageNumber == 1 {
-		pageOffset += headerSize
-	}
-
-	data, err := readBytesAtOffset(databaseFile, int64(pageOffset), 1)
-	if err != nil {
-		return rowIds
-	}
-
-	switch data[0] {
-	case 0x0D: // Leaf page
-		cellCount := getCellCount(databaseFile, pageOffset)
-
-		// loop through cell count
-		rootPage := 0
-		for i := int32(0); i < int32(cellCount); i++ {
-			cellPointerOffset := pageOffset + 8 + (i * 2)
-			cellContentOffset := getCellContentOffset(databaseFile, cellPointerOffset) // offset in the cell array is relative to the start of page
-			if pageNumber != 1 {                                                       // Only add if not first page since for the first page you don't want to offset 100 since its not
-				cellContentOffset += pageOffset
-			}
-
-			data, serialTypes, bodyOffset, _ := processLeafCellRecord(databaseFile, cellContentOffset)
-			var recordValues []string
-			for _, serialType := range serialTypes {
-				size := getSerialTypeSize(serialType)
-				value := data[bodyOffset : bodyOffset+int64(size)]
-				strValue := processSerialType(serialType, value)
-				recordValues = append(recordValues, strValue)
-				bodyOffset += int64(size)
-			}
-			// Change to get the index of the table name instead
-			if len(recordValues) >= 5 && recordValues[0] == "index" && recordValues[2] == tableName {
-				num, _ := strconv.Atoi(recordValues[3])
-				rootPage = num
-				break
-			}
+	case ".cell":
+		// Debugging aid that shows how one cell is parsed: .cell <page> <index>
+		if len(commandArgs) < 2 {
+			fmt.Fprintln(os.Stderr, "Usage: .cell <page> <index>")
+			return exitUsage
 		}
-
-		// this helper function should take in the rootPage of the index tree.. and from there find the row ids
-		// another function that takes in row ids and colNames or something to return back data (will also need to find rootpage i think)
-		whereValue := strings.Trim(strings.Join(rawWhereConditions[2:], " "), "'")
-		rowIds = getRowIdsFromIndexTreeHelper(databaseFile, int32(rootPage), pageSize, whereValue)
-
-		return rowIds
-
-	case 0x05: // Interior page
-		cellCount := getCellCount(databaseFile, pageOffset)
-
-		for i := int32(0); i < int32(cellCount); i++ {
-			cellPointerOffset := pageOffset + 12 + (i * 2)
-			cellContentOffset := getCellContentOffset(databaseFile, cellPointerOffset) // offset in the cell array is relative to the start of page
-			if pageNumber != 1 {                                                       // Only add if not first page since for the first page you don't want to offset 100 since its not start
-				cellContentOffset += pageOffset
-			}
-
-			data, err = readBytesAtOffset(databaseFile, int64(cellContentOffset), 4)
-			if err != nil {
-				continue
-			}
-			leftChildPageNumber := int32(binary.BigEndian.Uint32(data))
-			tempData := getRowIdsFromIndexTree(databaseFile, leftChildPageNumber, pageSize, tableName, rawWhereConditions)
-			rowIds = append(rowIds, tempData...)
+		pageNumber, pageErr := strconv.ParseInt(commandArgs[0], 10, 32)
+		index, indexErr := strconv.Atoi(commandArgs[1])
+		if pageErr != nil || indexErr != nil {
+			fmt.Fprintln(os.Stderr, "Usage: .cell <page> <index>")
+			return exitUsage
 		}
-
-		// Rightmost pointer
-		rightChildPageNumber := getRightmostChildPageNumber(databaseFile, pageOffset)
-		tempData := getRowIdsFromIndexTree(databaseFile, rightChildPageNumber, pageSize, tableName, rawWhereConditions)
-		rowIds = append(rowIds, tempData...)
-		return rowIds
-	}
-
-	return rowIds
-}
-
-func readDataByRowIdsHelper(databaseFile *os.File, pageNumber int32, pageSize int32, colIdx []int, rowIdTarget string) []string {
-	var columnData []string
-	const headerSize int32 = 100
-	var pageOffset int32 = (pageNumber - 1) * pageSize
-	if pageNumber == 1 {
-		pageOffset += headerSize
-	}
-
-	data, err := readBytesAtOffset(databaseFile, int64(pageOffset), 1)
-	if err != nil {
-		return columnData
-	}
-	rowIdIntTarget, _ := strconv.ParseInt(rowIdTarget, 10, 64)
-	switch data[0] {
-	case 0x0D: // Leaf page
-		cellCount := getCellCount(databaseFile, pageOffset)
-		// loop through cell count
-		for i := int32(0); i < int32(cellCount); i++ {
-			cellPointerOffset := pageOffset + 8 + (i * 2)
-			cellContentOffset := getCellContentOffset(databaseFile, cellPointerOffset) // offset in the cell array is relative to the start of page
-			if pageNumber != 1 {                                                       // Only add if not first page since for the first page you don't want to offset 100 since its not start
-				cellContentOffset += pageOffset
-			}
-
-			data, serialTypes, bodyOffset, rowId := processLeafCellRecord(databaseFile, cellContentOffset)
-			var rowValues []string
-			var dataForCol string = ""
-			if rowId == rowIdIntTarget {
-				for _, serialType := range serialTypes {
-					size := getSerialTypeSize(serialType)
-					value := data[bodyOffset : bodyOffset+int64(size)]
-					strValue := processSerialType(serialType, value)
-					rowValues = append(rowValues, strValue)
-					bodyOffset += int64(size)
-				}
-				rowValues[0] = strconv.FormatInt(rowId, 10)
-				for i, idx := range colIdx {
-					if idx >= 0 && idx <= len(rowValues) { // Check valid table indices excluding id
-						if i > 0 {
-							dataForCol += "|"
-						}
-						dataForCol += rowValues[idx]
-					}
-				}
-				columnData = append(columnData, dataForCol)
-				return columnData // Return immediately since rowid is unique
-			}
+		if pageNumber < 1 || pageNumber > int64(db.PageCount()) {
+			fmt.Fprintf(os.Stderr, "Error: page %d is out of range, the database has %d pages\n", pageNumber, db.PageCount())
+			return exitSQLError
 		}
-
-	case 0x05: // Interior page
-		cellCount := getCellCount(databaseFile, pageOffset)
-
-		for i := int32(0); i < int32(cellCount); i++ {
-			cellPointerOffset := pageOffset + 12 + (i * 2)
-			cellContentOffset := getCellContentOffset(databaseFile, cellPointerOffset) // offset in the cell array is relative to the start of page
-			if pageNumber != 1 {                                                       // Only add if not first page since for the first page you don't want to offset 100 since its not start
-				cellContentOffset += pageOffset
-			}
-			data, err = readBytesAtOffset(databaseFile, int64(cellContentOffset), 4)
-			if err != nil {
-				continue
-			}
-			leftChildPageNumber := int32(binary.BigEndian.Uint32(data))
-			data, err := readBytesAtOffset(databaseFile, int64(cellContentOffset+4), 9)
-			if err != nil {
-				continue
-			}
-			key, _ := readVarint(data, 0)
-			if int64(rowIdIntTarget) < key {
-				tempData := readDataByRowIdsHelper(databaseFile, leftChildPageNumber, pageSize, colIdx, rowIdTarget)
-				columnData = append(columnData, tempData...)
-				return columnData
-			} else if int64(rowIdIntTarget) == key {
-				tempData := readDataByRowIdsHelper(databaseFile, leftChildPageNumber, pageSize, colIdx, rowIdTarget)
-				columnData = append(columnData, tempData...)
-			}
+		cell, err := db.Cell(int32(pageNumber), index)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitSQLError
 		}
-
-		// Rightmost pointer
-		rightChildPageNumber := getRightmostChildPageNumber(databaseFile, pageOffset)
-		tempData := readDataByRowIdsHelper(databaseFile, rightChildPageNumber, pageSize, colIdx, rowIdTarget)
-		columnData = append(columnData, tempData...)
-		return columnData
-	}
-
-	return columnData
-}
-
-func readDataByRowIds(databaseFile *os.File, pageNumber int32, pageSize int32, tableName string, colNames []string, rowIds []string) []string {
-	var columnData []string
-	const headerSize int32 = 100
-	var pageOffset int32 = (pageNumber - 1) * pageSize
-	if pageNumber == 1 {
-		pageOffset += headerSize
-	}
-
-	data, err := readBytesAtOffset(databaseFile, int64(pageOffset), 1)
-	if err != nil {
-		return columnData
-	}
-
-	switch data[0] {
-	case 0x0D: // Leaf page
-		cellCount := getCellCount(databaseFile, pageOffset)
-
-		// loop through cell count
-		rootPage := 0
-		createStatement := ""
-		for i := int32(0); i < int32(cellCount); i++ {
-			cellPointerOffset := pageOffset + 8 + (i * 2)
-			cellContentOffset := getCellContentOffset(databaseFile, cellPointerOffset) // offset in the cell array is relative to the start of page
-			if pageNumber != 1 {                                                       // Only add if not first page since for the first page you don't want to offset 100 since its not
-				cellContentOffset += pageOffset
-			}
-
-			data, serialTypes, bodyOffset, _ := processLeafCellRecord(databaseFile, cellContentOffset)
-			var recordValues []string
-			for _, serialType := range serialTypes {
-				size := getSerialTypeSize(serialType)
-				value := data[bodyOffset : bodyOffset+int64(size)]
-				strValue := processSerialType(serialType, value)
-				recordValues = append(recordValues, strValue)
-				bodyOffset += int64(size)
-			}
-			if len(recordValues) >= 5 && recordValues[0] == "table" && recordValues[2] == tableName {
-				num, _ := strconv.Atoi(recordValues[3])
-				rootPage = num
-				createStatement = recordValues[4]
-				break
-			}
+		fmt.Printf("page %v cell %v at offset %v, page type %v\n", pageNumber, index, cell.Offset, cell.PageType)
+		if cell.PageType == pageTypeTableInterior || cell.PageType == pageTypeIndexInterior {
+			fmt.Printf("left child page: %v\n", cell.LeftChildPage)
 		}
-		// Get order of columnName in table
-		openParenIndex := strings.Index(createStatement, "(")
-		closeParenIndex := strings.LastIndex(createStatement, ")")
-		columnsPart := createStatement[openParenIndex+1 : closeParenIndex]
-		columnDefs := strings.Split(columnsPart, ",")
-		var colIdxs []int
-		for _, colName := range colNames {
-			for idx, colDef := range columnDefs {
-				colDef = strings.TrimSpace(colDef)
-				words := strings.Fields(colDef)
-				if len(words) > 0 && words[0] == colName {
-					colIdxs = append(colIdxs, idx)
-					break
-				}
-			}
+		if cell.PageType == pageTypeTableInterior || cell.PageType == pageTypeTableLeaf {
+			fmt.Printf("rowid: %v\n", cell.RowId)
 		}
-
-		// With the columnName order and rootpage, we can use them to find the column data
-		for _, rowId := range rowIds {
-			tempData := readDataByRowIdsHelper(databaseFile, int32(rootPage), pageSize, colIdxs, rowId)
-			columnData = append(columnData, tempData...)
+		if cell.PageType != pageTypeTableInterior {
+			fmt.Printf("header size: %v\n", cell.HeaderSize)
 		}
-
-		return columnData
-
-	case 0x05: // Interior page
-		cellCount := getCellCount(databaseFile, pageOffset)
-
-		for i := int32(0); i < int32(cellCount); i++ {
-			cellPointerOffset := pageOffset + 12 + (i * 2)
-			cellContentOffset := getCellContentOffset(databaseFile, cellPointerOffset) // offset in the cell array is relative to the start of page
-			if pageNumber != 1 {                                                       // Only add if not first page since for the first page you don't want to offset 100 since its not start
-				cellContentOffset += pageOffset
-			}
-
-			data, err = readBytesAtOffset(databaseFile, int64(cellContentOffset), 4)
-			if err != nil {
-				continue
-			}
-			leftChildPageNumber := int32(binary.BigEndian.Uint32(data))
-			tempData := readDataFromMultipleColumns(databaseFile, leftChildPageNumber, pageSize, tableName, colNames, rowIds)
-			columnData = append(columnData, tempData...)
+		for i, column := range cell.Columns {
+			fmt.Printf("column %v: serial type %v, %v bytes: %v\n", i, column.SerialType, column.Size, column.Value.SQLLiteral())
 		}
 
-		// Rightmost pointer
-		rightChildPageNumber := getRightmostChildPageNumber(databaseFile, pageOffset)
-		tempData := readDataFromMultipleColumns(databaseFile, rightChildPageNumber, pageSize, tableName, colNames, rowIds)
-		columnData = append(columnData, tempData...)
-		return columnData
-	}
-
-	return columnData
-}
-
-// Usage: your_program.sh sample.db .dbinfo
-func main() {
-	databaseFilePath := os.Args[1]
-	command := os.Args[2]
-
-	switch command {
-	case ".dbinfo":
-		databaseFile, err := os.Open(databaseFilePath)
-		if err != nil {
-			log.Fatal(err)
+	case ".rowids":
+		// Every rowid of a table one per line, without reading the rows themselves
+		if len(commandArgs) < 1 {
+			fmt.Fprintln(os.Stderr, "Usage: .rowids <table>")
+			return exitUsage
 		}
-		defer databaseFile.Close() // Ensure file is closed
-
-		header := make([]byte, 100)
-
-		_, err = databaseFile.Read(header)
+		rowIds, err := db.RowIds(commandArgs[0])
 		if err != nil {
-			log.Fatal(err)
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitSQLError
 		}
-
-		// Task 1: Getting page size
-		var pageSize uint16 // since reading two bytes
-		if err := binary.Read(bytes.NewReader(header[16:18]), binary.BigEndian, &pageSize); err != nil {
-			fmt.Println("Failed to read integer:", err)
-			return
+		for _, rowId := range rowIds {
+			fmt.Println(rowId)
 		}
 
-		// Task 1: Getting number of tables
-		var numTables int = countRecordsInBTree(databaseFile, 1, int32(pageSize)) // Page 1 or root page stores the tables in the BTree
-
-		fmt.Fprintln(os.Stderr, "Logs from your program will appear here!")
-
-		fmt.Printf("database page size: %v", pageSize)
-		fmt.Printf("number of tables: %v", numTables)
-
-	case ".tables":
-		databaseFile, err := os.Open(databaseFilePath)
-		if err != nil {
-			log.Fatal(err)
+	case ".mode":
+		// Without an argument show the current mode, otherwise switch the format for the statements that follow
+		if len(commandArgs) == 0 {
+			fmt.Printf("current output mode: %s\n", settings.Mode)
+			break
 		}
-		defer databaseFile.Close() // Ensure file is closed
-
-		header := make([]byte, 100)
+		if _, ok := outputFormatters[commandArgs[0]]; !ok {
+			fmt.Fprintf(os.Stderr, "Error: mode should be one of: %s\n", strings.Join(outputModeNames(), " "))
+			return exitSQLError
+		}
+		settings.Mode = commandArgs[0]
 
-		_, err = databaseFile.Read(header)
+	case ".dump":
+		lines, err := db.Dump()
 		if err != nil {
-			log.Fatal(err)
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitDatabase
 		}
-		var pageSize uint16 // since reading two bytes
-		if err := binary.Read(bytes.NewReader(header[16:18]), binary.BigEndian, &pageSize); err != nil {
-			fmt.Println("Failed to read integer:", err)
-			return
-		}
-		// Task 2: Get names of tables
-		tableNames := getTablesNamesInBTree(databaseFile, 1, int32(pageSize))
-
-		for i, name := range tableNames {
-			if i != len(tableNames)-1 {
-				fmt.Printf("%s", name+" ")
-			} else {
-				fmt.Print(name)
-			}
+		for _, line := range lines {
+			fmt.Println(line)
 		}
 
 	// SQL Commands
 	default:
-		databaseFile, err := os.Open(databaseFilePath)
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer databaseFile.Close() // Ensure file is closed
-
-		header := make([]byte, 100)
-
-		_, err = databaseFile.Read(header)
-		if err != nil {
-			log.Fatal(err)
-		}
-		var pageSize uint16 // since reading two bytes
-		if err := binary.Read(bytes.NewReader(header[16:18]), binary.BigEndian, &pageSize); err != nil {
-			fmt.Println("Failed to read integer:", err)
-			return
+		if strings.HasPrefix(commandName, ".") {
+			fmt.Fprintf(os.Stderr, "Error: unknown command: %s\n", commandName)
+			return exitUsage
+		}
+		// A statement pasted with its terminating semicolon would otherwise end the last word, e.g. the table name
+		command = strings.TrimRight(command, "; \t\r\n")
+		words := tokenizeSQL(command)
+		if len(words) >= 2 && strings.ToLower(words[0]) == "pragma" {
+			pragmaName, pragmaArgument := parsePragma(words[1:])
+			columnNames, rows, err := db.Pragma(pragmaName, pragmaArgument)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return exitSQLError
+			}
+			printRows(*settings, columnNames, rows)
+			return exitSuccess
 		}
-
-		words := strings.Fields(command)
 		var fromWordIndex int = 0
 		var whereWordIndex int = -1
+		var limitWordIndex int = -1
+		var orderWordIndex int = -1
+		var groupWordIndex int = -1
+		var havingWordIndex int = -1
 		for i, word := range words {
+			if strings.ToLower(word) == "order" && i+1 < len(words) && strings.ToLower(words[i+1]) == "by" {
+				orderWordIndex = i
+			}
+			if strings.ToLower(word) == "group" && i+1 < len(words) && strings.ToLower(words[i+1]) == "by" {
+				groupWordIndex = i
+			}
+			if strings.ToLower(word) == "having" {
+				havingWordIndex = i
+			}
 			if strings.ToLower(word) == "from" {
 				fromWordIndex = i
 			}
 			if strings.ToLower(word) == "where" {
 				whereWordIndex = i
 			}
+			if strings.ToLower(word) == "limit" {
+				limitWordIndex = i
+			}
+		}
+		if len(words) < 2 || strings.ToLower(words[0]) != "select" || fromWordIndex+1 >= len(words) {
+			fmt.Fprintf(os.Stderr, "Error: unsupported statement: %s\n", command)
+			return exitSQLError
+		}
+		// Every result column has to be written out, SELECT FROM t or a comma with nothing after it is a syntax error
+		resultColumns := splitTopLevelCommas(strings.Join(words[1:max(fromWordIndex, 1)], " "))
+		for i, column := range resultColumns {
+			if fromWordIndex != 0 && strings.TrimSpace(column) == "" {
+				near := ","
+				if i == len(resultColumns)-1 {
+					near = words[fromWordIndex]
+				}
+				fmt.Fprintf(os.Stderr, "Error: near %q: syntax error\n", near)
+				return exitSQLError
+			}
+		}
+		if fromWordIndex == 0 {
+			// No FROM, every result column has to be a constant like SELECT 1, 'a' or sqlite_version()
+			result, err := db.SelectExpressions(splitTopLevelCommas(strings.Join(words[1:], " ")))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return exitSQLError
+			}
+			fmt.Println(result)
+			printStats(*settings, 1)
+			return exitSuccess
+		}
+		// The FROM clause runs up to WHERE, GROUP BY, HAVING, ORDER BY or LIMIT and can list several tables to cross join
+		fromEndIndex := len(words)
+		for _, index := range []int{whereWordIndex, groupWordIndex, havingWordIndex, orderWordIndex, limitWordIndex} {
+			if index > fromWordIndex && index < fromEndIndex {
+				fromEndIndex = index
+			}
 		}
-		tableName := words[fromWordIndex+1]
+		tableRefs, err := parseTableList(words[fromWordIndex+1 : fromEndIndex])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitSQLError
+		}
+		if len(tableRefs) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: unsupported statement: %s\n", command)
+			return exitSQLError
+		}
+		tableName := tableRefs[0].Name
+		isJoin := len(tableRefs) > 1
 		if strings.ToLower(words[0]) == "select" {
+			// Task 6: Support Where Clause
+			var whereClause WhereClause
+			if whereWordIndex != -1 {
+				whereEndIndex := len(words)
+				for _, index := range []int{groupWordIndex, havingWordIndex, orderWordIndex, limitWordIndex} {
+					if index > whereWordIndex && index < whereEndIndex {
+						whereEndIndex = index
+					}
+				}
+				whereClause, err = parseWhereClause(words[whereWordIndex+1 : whereEndIndex])
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					return exitSQLError
+				}
+			}
+
+			// A single table query accepts columns qualified with the table name like apples.name
+			if !isJoin {
+				if column, ok := stripWhereQualifiers(tableRefs[0], whereClause); !ok {
+					fmt.Fprintf(os.Stderr, "Error: no such column: %s\n", column)
+					return exitSQLError
+				}
+			}
+
+			// Task 9: Support ORDER BY <column> [ASC|DESC]
+			var orderBy OrderBy
+			if orderWordIndex != -1 {
+				if orderWordIndex+2 >= len(words) {
+					fmt.Fprintln(os.Stderr, "Error: incomplete input")
+					return exitSQLError
+				}
+				if orderWordIndex+2 == limitWordIndex {
+					fmt.Fprintf(os.Stderr, "Error: near %q: syntax error\n", words[limitWordIndex])
+					return exitSQLError
+				}
+				orderBy.Column = unquoteIdentifier(words[orderWordIndex+2])
+				if orderWordIndex+3 < len(words) && strings.ToLower(words[orderWordIndex+3]) == "desc" {
+					orderBy.Descending = true
+				}
+			}
+			// ORDER BY has to name a column even when the result is a single aggregate row that it doesn't reorder
+			if orderBy.Column != "" && !isJoin {
+				column, ok := stripTableQualifier(tableRefs[0], orderBy.Column)
+				err := fmt.Errorf("no such column: %s", orderBy.Column)
+				if ok {
+					err = db.checkColumns(tableName, []string{column}, nil)
+				}
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					return exitSQLError
+				}
+			}
+
+			// Aggregates are matched with the whitespace between tokens removed so COUNT( * ) and count (*) work too
+			resultExpression := strings.Join(words[1:fromWordIndex], "")
+
+			if groupWordIndex != -1 || havingWordIndex != -1 {
+				// GROUP BY <column> [HAVING <conditions>], the result columns are aggregates or columns of the group
+				if isJoin {
+					fmt.Fprintln(os.Stderr, "Error: GROUP BY over multiple tables is not supported")
+					return exitSQLError
+				}
+				if groupWordIndex == -1 || groupWordIndex+2 >= len(words) || havingWordIndex != -1 && havingWordIndex < groupWordIndex {
+					fmt.Fprintln(os.Stderr, "Error: a HAVING clause needs a GROUP BY clause")
+					return exitSQLError
+				}
+				if orderWordIndex != -1 {
+					fmt.Fprintln(os.Stderr, "Error: ORDER BY with GROUP BY is not supported")
+					return exitSQLError
+				}
+				groupColumn, ok := stripTableQualifier(tableRefs[0], unquoteIdentifier(words[groupWordIndex+2]))
+				if !ok {
+					fmt.Fprintf(os.Stderr, "Error: no such column: %s\n", words[groupWordIndex+2])
+					return exitSQLError
+				}
+				var having WhereClause
+				if havingWordIndex != -1 {
+					havingEndIndex := len(words)
+					if limitWordIndex > havingWordIndex {
+						havingEndIndex = limitWordIndex
+					}
+					having, err = parseWhereClause(joinParenthesizedWords(words[havingWordIndex+1 : havingEndIndex]))
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+						return exitSQLError
+					}
+				}
+				var limit int = -1
+				var offset int = 0
+				if limitWordIndex != -1 {
+					if limitWordIndex+1 >= len(words) {
+						fmt.Fprintln(os.Stderr, "Error: incomplete input")
+						return exitSQLError
+					}
+					num, skip, ok := parseLimitClause(words[limitWordIndex+1:])
+					if !ok {
+						fmt.Fprintln(os.Stderr, "Error: invalid LIMIT:", strings.Join(words[limitWordIndex+1:], " "))
+						return exitSQLError
+					}
+					limit, offset = num, skip
+				}
+
+				expressions, headers := parseExpressionList(words[1:fromWordIndex])
+				rows, err := db.QueryGroups(tableName, expressions, groupColumn, whereClause, having)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					return exitSQLError
+				}
+				if offset >= len(rows) {
+					rows = nil
+				} else {
+					rows = rows[offset:]
+				}
+				if limit != -1 && limit < len(rows) {
+					rows = rows[:limit]
+				}
+				printRows(*settings, headers, rows)
+				return exitSuccess
+			}
+
+			// Several aggregates like SELECT min(v), max(v) are computed over the same rows and printed as one row
+			if expressions, headers := parseExpressionList(words[1:fromWordIndex]); len(expressions) > 1 && slices.ContainsFunc(expressions, isAggregateExpression) {
+				if isJoin {
+					fmt.Fprintln(os.Stderr, "Error: aggregates over multiple tables are not supported")
+					return exitSQLError
+				}
+				values, err := db.QueryAggregates(tableName, expressions, whereClause)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					return exitSQLError
+				}
+				printRows(*settings, headers, Rows{values})
+				return exitSuccess
+			}
+
 			// Task 3: Process Count Command
-			if strings.ToLower(words[1]) == "count(*)" {
+			if strings.ToLower(resultExpression) == "count(*)" {
 				// Get count
-				numRows := getCountInATable(databaseFile, 1, int32(pageSize), tableName)
+				if isJoin {
+					rows, err := db.QueryJoin(tableRefs, []string{"*"}, whereClause, OrderBy{}, -1, 0)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+						return exitSQLError
+					}
+					fmt.Printf("%d\n", len(rows))
+					printStats(*settings, 1)
+					return exitSuccess
+				}
+				numRows, err := db.Count(tableName, whereClause)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					return exitSQLError
+				}
 				fmt.Printf("%d\n", numRows)
+				printStats(*settings, 1)
+			} else if aggregate, colName, ok := parseAggregate(resultExpression); ok {
+				if isJoin {
+					fmt.Fprintln(os.Stderr, "Error: aggregates over multiple tables are not supported")
+					return exitSQLError
+				}
+				// Task 10: Process SUM, AVG, MIN and MAX over a single column
+				column, ok := stripTableQualifier(tableRefs[0], colName)
+				if !ok {
+					fmt.Fprintf(os.Stderr, "Error: no such column: %s\n", colName)
+					return exitSQLError
+				}
+				result, err := db.Aggregate(aggregate, tableName, column, whereClause)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					return exitSQLError
+				}
+				fmt.Println(result)
+				printStats(*settings, 1)
 			} else {
 				// Task 4: Get column data
 
 				// Find word from to find out how many columns
-				var colNames []string
+				// Task 5: Allow multiple columns, aliases are kept for when headers are printed
+				colNames, aliases := parseColumnList(words[1:fromWordIndex])
+
+				// Task 8: Support LIMIT, -1 is a marker for no limit. OFFSET skips that many matching rows first.
+				var limit int = -1
+				var offset int = 0
+				if limitWordIndex != -1 {
+					if limitWordIndex+1 >= len(words) {
+						fmt.Fprintln(os.Stderr, "Error: incomplete input")
+						return exitSQLError
+					}
+					num, skip, ok := parseLimitClause(words[limitWordIndex+1:])
+					if !ok {
+						fmt.Fprintln(os.Stderr, "Error: invalid LIMIT:", strings.Join(words[limitWordIndex+1:], " "))
+						return exitSQLError
+					}
+					limit, offset = num, skip
+				}
 
-				// Task 5: Allow multiple columns
-				for i := 1; i < fromWordIndex; i++ {
-					if i != fromWordIndex-1 {
-						colNames = append(colNames, strings.TrimRight(words[i], ","))
-					} else {
-						colNames = append(colNames, words[i])
+				// Task 11: Result columns can be expressions like price * quantity, evaluated for every row
+				expressions, headers := parseExpressionList(words[1:fromWordIndex])
+				hasComputedExpression := false
+				for _, expression := range expressions {
+					hasComputedExpression = hasComputedExpression || isComputedExpression(expression)
+				}
+				if hasComputedExpression {
+					if isJoin {
+						fmt.Fprintln(os.Stderr, "Error: expressions over multiple tables are not supported")
+						return exitSQLError
+					}
+					column, ok := stripTableQualifier(tableRefs[0], orderBy.Column)
+					if !ok {
+						fmt.Fprintf(os.Stderr, "Error: no such column: %s\n", orderBy.Column)
+						return exitSQLError
+					}
+					orderBy.Column = column
+					columnNames, rows, err := db.QueryExpressions(tableRefs[0], expressions, headers, whereClause, orderBy, limit, offset)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+						return exitSQLError
 					}
+					printRows(*settings, columnNames, rows)
+					return exitSuccess
 				}
 
-				// Task 6: Support Where Clause
-				var whereConditions []string
-				if whereWordIndex != -1 {
-					whereConditions = words[whereWordIndex+1:]
+				if isJoin {
+					rows, err := db.QueryJoin(tableRefs, colNames, whereClause, orderBy, limit, offset)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+						return exitSQLError
+					}
+					printRows(*settings, db.JoinColumnNames(tableRefs, colNames, aliases), rows)
+					return exitSuccess
 				}
 
-				// Task 7: Support index
-				// Grab where if country then search index
-				if len(whereConditions) != 0 && whereConditions[0] == "country" {
-					// Search Index tree to return array of rowids
-					// With this rowids, search the table tree
-					rowIds := getRowIdsFromIndexTree(databaseFile, 1, int32(pageSize), tableName, whereConditions)
-					columnData := readDataByRowIds(databaseFile, 1, int32(pageSize), tableName, colNames, rowIds)
-					for _, data := range columnData {
-						fmt.Println(data)
+				for i, colName := range append(colNames, orderBy.Column) {
+					column, ok := stripTableQualifier(tableRefs[0], colName)
+					if !ok {
+						fmt.Fprintf(os.Stderr, "Error: no such column: %s\n", colName)
+						return exitSQLError
 					}
-				} else {
-					columnData := readDataFromMultipleColumns(databaseFile, 1, int32(pageSize), tableName, colNames, whereConditions)
-					for _, data := range columnData {
-						fmt.Println(data)
+					if i < len(colNames) {
+						if aliases[i] == colName {
+							aliases[i] = column // Headers show the bare column name like sqlite3
+						}
+						colNames[i] = column
+					} else {
+						orderBy.Column = column
 					}
 				}
 
+				rows, err := db.Query(tableName, colNames, whereClause, orderBy, limit, offset)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					return exitSQLError
+				}
+				printRows(*settings, db.ColumnNames(tableName, colNames, aliases), rows)
 			}
 
 		}
-		os.Exit(1)
 	}
+
+	return exitSuccess
 }
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// runCaptured runs a command like the sqlite3 command line does with the default list mode and returns what it wrote
+// to stdout along with its exit code
+func runCaptured(t *testing.T, db *Database, command string) (string, int) {
+	t.Helper()
+	return captureOutput(t, &os.Stdout, db, command)
+}
+
+// runCapturedError runs a command like runCaptured but returns what it wrote to stderr, where errors are reported
+func runCapturedError(t *testing.T, db *Database, command string) (string, int) {
+	t.Helper()
+	return captureOutput(t, &os.Stderr, db, command)
+}
+
+// captureOutput runs a command in list mode while file, os.Stdout or os.Stderr, is redirected into a pipe
+func captureOutput(t *testing.T, file **os.File, db *Database, command string) (string, int) {
+	t.Helper()
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := *file
+	*file = writer
+	output := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(reader)
+		output <- string(data)
+	}()
+	settings := OutputSettings{Mode: "list", Separator: "|"}
+	code := runCommand(db, command, nil, &settings, false)
+	*file = original
+	writer.Close()
+	return <-output, code
+}
+
+// applesDB is a small table of apples, like the sample database
+func applesDB(t *testing.T) *Database {
+	t.Helper()
+	b := newTestDB(t, 4096)
+	b.addTable("apples", "CREATE TABLE apples\n(\n\tid integer primary key autoincrement,\n\tname text,\n\tcolor text\n)",
+		testRow{1, []any{nil, "Granny Smith", "Light Green"}},
+		testRow{2, []any{nil, "Fuji", "Red"}},
+		testRow{3, []any{nil, "Honeycrisp", "Blush Red"}},
+		testRow{4, []any{nil, "Golden Delicious", "Yellow"}})
+	return b.open()
+}
+
+func TestSelectWithRaggedSpacing(t *testing.T) {
+	db := applesDB(t)
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"SELECT name,color FROM apples WHERE id = 2", "Fuji|Red\n"},
+		{"SELECT   name ,color\t,  id   FROM apples WHERE id = 2", "Fuji|Red|2\n"},
+		{"\tSELECT\n\tname\n\t,\n\tcolor\nFROM\napples\nWHERE\nid\n=\n2", "Fuji|Red\n"},
+		{"SELECT name , color  FROM  apples  WHERE  id=2 ;", "Fuji|Red\n"},
+		{"select  name,  id  from apples  where color = 'Blush Red'", "Honeycrisp|3\n"},
+		{"SELECT  COUNT( * )  FROM apples", "4\n"},
+		{"SELECT max( id ) ,  min(id)  FROM apples", "4|1\n"},
+	}
+	for _, tt := range tests {
+		if got, code := runCaptured(t, db, tt.command); got != tt.want || code != exitSuccess {
+			t.Errorf("%q printed %q with exit code %d, want %q", tt.command, got, code, tt.want)
+		}
+	}
+}
+
+func TestParseColumnListWithRaggedSpacing(t *testing.T) {
+	for _, statement := range []string{"name,color,id", "name , color , id", " name,\tcolor ,\n id ", "name ,color\t,  id"} {
+		colNames, aliases := parseColumnList(tokenizeSQL(statement))
+		if want := []string{"name", "color", "id"}; !slices.Equal(colNames, want) || !slices.Equal(aliases, want) {
+			t.Errorf("parseColumnList(%q) = %v, %v, want %v", statement, colNames, aliases, want)
+		}
+	}
+}
+
+func TestQuotedReservedWordColumns(t *testing.T) {
+	b := newTestDB(t, 4096)
+	b.addTable("orders", "CREATE TABLE orders(id integer primary key, \"order\" INTEGER, [group] text, `select` text)",
+		testRow{1, []any{nil, 10, "a", "x"}},
+		testRow{2, []any{nil, 20, "b", "y"}},
+		testRow{3, []any{nil, 30, "a", "z"}})
+	db := b.open()
+
+	got := queryStrings(t, db, "orders", []string{"order", "group", "select"}, mustParseWhere(t, "\"order\" >= 20"))
+	if want := [][]string{{"20", "b", "y"}, {"30", "a", "z"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("\"order\" >= 20 returned %v, want %v", got, want)
+	}
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{`SELECT "order" FROM orders`, "10\n20\n30\n"},
+		{`SELECT id, "order" FROM orders WHERE [group] = 'a'`, "1|10\n3|30\n"},
+		{"SELECT `select`, [order] FROM orders WHERE \"order\" = 20", "y|20\n"},
+		{`SELECT sum("order") FROM orders`, "60\n"},
+	}
+	for _, tt := range tests {
+		if got, code := runCaptured(t, db, tt.command); got != tt.want || code != exitSuccess {
+			t.Errorf("%q printed %q with exit code %d, want %q", tt.command, got, code, tt.want)
+		}
+	}
+}
+
+func TestApostrophesInData(t *testing.T) {
+	b := newTestDB(t, 4096)
+	b.addTable("people", "CREATE TABLE people(id integer primary key, name text)",
+		testRow{1, []any{nil, "O'Brien"}},
+		testRow{2, []any{nil, "D'Arcy"}},
+		testRow{3, []any{nil, "Smith"}},
+		testRow{4, []any{nil, "'quoted'"}})
+	b.addIndex("index", "people_name", "people", "CREATE INDEX people_name ON people(name)",
+		[]any{"'quoted'", 4}, []any{"D'Arcy", 2}, []any{"O'Brien", 1}, []any{"Smith", 3})
+	db := b.open()
+
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"SELECT id FROM people WHERE name = 'O''Brien'", "1\n"},
+		{"SELECT id FROM people WHERE name='O''Brien'", "1\n"},
+		{"SELECT id FROM people WHERE name = '''quoted'''", "4\n"},
+		{"SELECT id FROM people WHERE name IN ('D''Arcy', 'O''Brien')", "1\n2\n"},
+		{"SELECT id FROM people WHERE name LIKE '%''%'", "1\n2\n4\n"},
+		{"SELECT id FROM people WHERE name != 'O''Brien' AND name > 'D''Arcy'", "3\n"},
+		{"SELECT name FROM people WHERE id = 2", "D'Arcy\n"},
+		{"SELECT count(*) FROM people WHERE name = 'OBrien'", "0\n"},
+	}
+	for _, tt := range tests {
+		if got, code := runCaptured(t, db, tt.command); got != tt.want || code != exitSuccess {
+			t.Errorf("%q printed %q with exit code %d, want %q", tt.command, got, code, tt.want)
+		}
+	}
+}
+
+func TestIncompleteWhereFailsInsteadOfMatchingEveryRow(t *testing.T) {
+	db := applesDB(t)
+	for _, command := range []string{
+		"SELECT name FROM apples WHERE id =",
+		"SELECT name FROM apples WHERE id = 2 AND",
+		"SELECT COUNT(*) FROM apples WHERE color",
+	} {
+		if got, code := runCaptured(t, db, command); got != "" || code == exitSuccess {
+			t.Errorf("%q printed %q with exit code %d, want no rows and a failure", command, got, code)
+		}
+	}
+}
+
+func TestWhereWithoutSpacesAroundOperators(t *testing.T) {
+	db := applesDB(t)
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"SELECT name FROM apples WHERE id>=3", "Honeycrisp\nGolden Delicious\n"},
+		{"SELECT name FROM apples WHERE id<>1 AND id<=2", "Fuji\n"},
+		{"SELECT id FROM apples WHERE color=='Red'", "2\n"},
+		{"SELECT COUNT(*) FROM apples WHERE id!=4", "3\n"},
+	}
+	for _, tt := range tests {
+		if got, code := runCaptured(t, db, tt.command); got != tt.want || code != exitSuccess {
+			t.Errorf("%q printed %q with exit code %d, want %q", tt.command, got, code, tt.want)
+		}
+	}
+}
+
+func TestCellCommandChecksPageNumber(t *testing.T) {
+	db := applesDB(t)
+	if got, code := runCaptured(t, db, ".cell 2 1"); code != exitSuccess || !strings.HasPrefix(got, "page 2 cell 1 at offset") {
+		t.Errorf(".cell 2 1 printed %q with exit code %d", got, code)
+	}
+	tests := []struct {
+		command string
+		code    int
+	}{
+		{".cell 4294967298 0", exitUsage}, // Wraps to page 2 if truncated to 32 bits
+		{".cell 2147483648 0", exitUsage},
+		{".cell 0 0", exitSQLError},
+		{".cell -1 0", exitSQLError},
+		{".cell 3 0", exitSQLError},
+		{".cell x 0", exitUsage},
+	}
+	for _, tt := range tests {
+		if got, code := runCaptured(t, db, tt.command); got != "" || code != tt.code {
+			t.Errorf("%q printed %q with exit code %d, want exit code %d", tt.command, got, code, tt.code)
+		}
+	}
+}
+
+func TestSelectSeveralAggregates(t *testing.T) {
+	db := applesDB(t)
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"SELECT count(*), min(name), max(id) FROM apples", "4|Fuji|4\n"},
+		{"SELECT sum(id), avg(id), min(color) FROM apples WHERE id > 1", "9|3.0|Blush Red\n"},
+		{"SELECT count(*), max(name) FROM apples WHERE id > 10", "0|NULL\n"},
+		// A bare column takes its value from the row of a min or max, otherwise from the first row, like in sqlite3
+		{"SELECT name, count(*) FROM apples", "Granny Smith|4\n"},
+		{"SELECT count(*), name FROM apples WHERE id > 1", "3|Fuji\n"},
+		{"SELECT name, max(id) FROM apples", "Golden Delicious|4\n"},
+		{"SELECT name, min(color) FROM apples", "Honeycrisp|Blush Red\n"},
+		{"SELECT name, min(id), max(id) FROM apples", "Golden Delicious|1|4\n"},
+		{"SELECT name, count(*) FROM apples WHERE id > 10", "NULL|0\n"},
+	}
+	for _, tt := range tests {
+		if got, code := runCaptured(t, db, tt.command); got != tt.want || code != exitSuccess {
+			t.Errorf("%q printed %q with exit code %d, want %q", tt.command, got, code, tt.want)
+		}
+	}
+}
+
+func TestOrderByErrors(t *testing.T) {
+	db := applesDB(t)
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"SELECT name FROM apples ORDER BY", "Error: incomplete input\n"},
+		{"SELECT name FROM apples ORDER BY LIMIT 2", "Error: near \"LIMIT\": syntax error\n"},
+		{"SELECT name FROM apples ORDER BY nosuch", "Error: no such column: nosuch\n"},
+		{"SELECT name FROM apples WHERE id > 1 ORDER BY nosuch DESC", "Error: no such column: nosuch\n"},
+		{"SELECT id * 2 FROM apples ORDER BY nosuch", "Error: no such column: nosuch\n"},
+		{"SELECT a.name FROM apples a JOIN apples b ON a.id = b.id ORDER BY nosuch", "Error: no such column: nosuch\n"},
+	}
+	for _, tt := range tests {
+		if got, code := runCapturedError(t, db, tt.command); got != tt.want || code != exitSQLError {
+			t.Errorf("%q reported %q with exit code %d, want %q", tt.command, got, code, tt.want)
+		}
+	}
+}
+
+func TestLimitClause(t *testing.T) {
+	db := applesDB(t)
+	// Like in sqlite a negative limit returns every row and a negative offset skips none
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"SELECT id FROM apples LIMIT -1", "1\n2\n3\n4\n"},
+		{"SELECT id FROM apples LIMIT 2 OFFSET -1", "1\n2\n"},
+		{"SELECT id FROM apples LIMIT -3, 2", "1\n2\n"},
+		{"SELECT id FROM apples ORDER BY name LIMIT -1 OFFSET 2", "1\n3\n"},
+		{"SELECT color, count(*) FROM apples GROUP BY color LIMIT -1 OFFSET 3", "Yellow|1\n"},
+	}
+	for _, tt := range tests {
+		if got, code := runCaptured(t, db, tt.command); got != tt.want || code != exitSuccess {
+			t.Errorf("%q printed %q with exit code %d, want %q", tt.command, got, code, tt.want)
+		}
+	}
+	for _, command := range []string{
+		"SELECT id FROM apples LIMIT",
+		"SELECT id FROM apples WHERE id = 1 LIMIT",
+		"SELECT color, count(*) FROM apples GROUP BY color LIMIT",
+	} {
+		if got, code := runCapturedError(t, db, command); got != "Error: incomplete input\n" || code != exitSQLError {
+			t.Errorf("%q reported %q with exit code %d, want incomplete input", command, got, code)
+		}
+	}
+}
+
+func TestMissingResultColumnsAndUnknownOrderByColumns(t *testing.T) {
+	db := applesDB(t)
+	// Expected errors are what sqlite3 reports
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"SELECT FROM apples", "Error: near \"FROM\": syntax error\n"},
+		{"SELECT FROM apples WHERE id = 1", "Error: near \"FROM\": syntax error\n"},
+		{"SELECT name, FROM apples", "Error: near \"FROM\": syntax error\n"},
+		{"SELECT count(*), FROM apples", "Error: near \"FROM\": syntax error\n"},
+		{"SELECT name,, color FROM apples", "Error: near \",\": syntax error\n"},
+		{"SELECT , name FROM apples", "Error: near \",\": syntax error\n"},
+		{"SELECT count(*) FROM apples ORDER BY nosuch", "Error: no such column: nosuch\n"},
+		{"SELECT count(*), min(id) FROM apples ORDER BY nosuch", "Error: no such column: nosuch\n"},
+		{"SELECT max(id) FROM apples ORDER BY oranges.id", "Error: no such column: oranges.id\n"},
+		{"SELECT color, count(*) FROM apples GROUP BY color ORDER BY nosuch", "Error: no such column: nosuch\n"},
+	}
+	for _, tt := range tests {
+		if got, code := runCapturedError(t, db, tt.command); got != tt.want || code != exitSQLError {
+			t.Errorf("%q reported %q with exit code %d, want %q", tt.command, got, code, tt.want)
+		}
+	}
+	if got, code := runCaptured(t, db, "SELECT count(*) FROM apples ORDER BY apples.name"); got != "4\n" || code != exitSuccess {
+		t.Errorf("ordering a count by a qualified column printed %q with exit code %d, want 4", got, code)
+	}
+}
+
+func TestGroupByBareColumns(t *testing.T) {
+	b := newTestDB(t, 4096)
+	b.addTable("t", "CREATE TABLE t(id integer primary key, g, v, n)",
+		testRow{1, []any{nil, "a", "x1", 5}},
+		testRow{2, []any{nil, "b", "y1", 9}},
+		testRow{3, []any{nil, "a", "x2", 9}},
+		testRow{4, []any{nil, "b", "y2", nil}},
+		testRow{5, []any{nil, "a", "x3", 1}},
+		testRow{6, []any{nil, "a", "x4", 1}})
+	db := b.open()
+
+	// Expected rows are what sqlite3 prints for the same data
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"SELECT g, v, count(*) FROM t GROUP BY g", "a|x1|4\nb|y1|2\n"},
+		{"SELECT v, max(n) FROM t GROUP BY g", "x2|9\ny1|9\n"},
+		{"SELECT v, min(n) FROM t GROUP BY g", "x3|1\ny1|9\n"},
+		{"SELECT v, min(n) FROM t", "x3|1\n"},
+		{"SELECT v, max(n) FROM t WHERE id = 4", "y2|NULL\n"},
+	}
+	for _, tt := range tests {
+		if got, code := runCaptured(t, db, tt.command); got != tt.want || code != exitSuccess {
+			t.Errorf("%q printed %q with exit code %d, want %q", tt.command, got, code, tt.want)
+		}
+	}
+}
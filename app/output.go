@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// OutputSettings is how results are printed. It outlives a single statement so .mode can change it for the ones after.
+type OutputSettings struct {
+	Mode      string // one of the outputFormatters keys
+	Header    bool   // print the column names first, ignored by json
+	Separator string // between values in list mode
+	Stats     bool   // report the number of result rows on stderr after each query
+
+	// BoolColumns are the lowercased names of result columns whose integers 0 and 1 are shown as false and true
+	BoolColumns map[string]bool
+}
+
+// outputFormatter renders a whole result set, each output mode is one
+type outputFormatter func(columnNames []string, rows Rows, settings OutputSettings) string
+
+var outputFormatters = map[string]outputFormatter{
+	"list": func(columnNames []string, rows Rows, settings OutputSettings) string {
+		return formatList(columnNames, rows, settings.Header, settings.Separator)
+	},
+	"csv": func(columnNames []string, rows Rows, settings OutputSettings) string {
+		return formatCSV(columnNames, rows, settings.Header)
+	},
+	"json": func(columnNames []string, rows Rows, settings OutputSettings) string {
+		return formatJSON(columnNames, rows)
+	},
+	"column": func(columnNames []string, rows Rows, settings OutputSettings) string {
+		return formatColumns(columnNames, rows, settings.Header)
+	},
+}
+
+// outputModeNames lists the modes .mode accepts in alphabetical order
+func outputModeNames() []string {
+	var names []string
+	for name := range outputFormatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// formatRows renders a result set with the formatter of the settings' mode, list when the mode is unknown
+func formatRows(settings OutputSettings, columnNames []string, rows Rows) string {
+	formatter, ok := outputFormatters[settings.Mode]
+	if !ok {
+		formatter = outputFormatters["list"]
+	}
+	if len(settings.BoolColumns) > 0 {
+		rows = renderBoolColumns(columnNames, rows, settings.BoolColumns)
+	}
+	return formatter(columnNames, rows, settings)
+}
+
+// printRows prints a result set to stdout followed by its row count when stats are on. Like sqlite3, an empty result
+// prints nothing, not even the header.
+func printRows(settings OutputSettings, columnNames []string, rows Rows) {
+	if len(rows) > 0 {
+		fmt.Println(formatRows(settings, columnNames, rows))
+	}
+	printStats(settings, len(rows))
+}
+
+// printStats writes the row count of a query to stderr when stats are on, so stdout only holds the results
+func printStats(settings OutputSettings, rowCount int) {
+	if !settings.Stats {
+		return
+	}
+	if rowCount == 1 {
+		fmt.Fprintln(os.Stderr, "1 row")
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%d rows\n", rowCount)
+}
+
+// renderBoolColumns returns a copy of rows where the 0 and 1 integers of boolColumns are replaced by bool values,
+// other values of those columns are left alone
+func renderBoolColumns(columnNames []string, rows Rows, boolColumns map[string]bool) Rows {
+	rendered := make(Rows, len(rows))
+	for r, row := range rows {
+		rendered[r] = append([]Value(nil), row...)
+		for i, value := range row {
+			if i >= len(columnNames) || !boolColumns[strings.ToLower(columnNames[i])] {
+				continue
+			}
+			if integer, ok := value.Data.(int64); ok && (integer == 0 || integer == 1) {
+				rendered[r][i].Data = integer == 1
+			}
+		}
+	}
+	return rendered
+}
+
+// formatList renders one line per row with the values joined by separator, | unless -separator says otherwise
+func formatList(columnNames []string, rows Rows, header bool, separator string) string {
+	var lines []string
+	if header {
+		lines = append(lines, strings.Join(columnNames, separator))
+	}
+	for _, row := range rows {
+		strValues := make([]string, len(row))
+		for i, value := range row {
+			strValues[i] = value.String()
+		}
+		lines = append(lines, strings.Join(strValues, separator))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatCSV renders rows as RFC 4180 CSV so values containing commas, quotes or newlines survive, NULL is an empty field
+func formatCSV(columnNames []string, rows Rows, header bool) string {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if header {
+		writer.Write(columnNames)
+	}
+	for _, row := range rows {
+		record := make([]string, len(row))
+		for i, value := range row {
+			if !value.IsNull() {
+				record[i] = value.String()
+			}
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// formatColumns renders rows as left aligned columns two spaces apart, each as wide as its longest value or name.
+// With header the names are underlined with dashes. NULL is left blank like in sqlite3's column mode.
+func formatColumns(columnNames []string, rows Rows, header bool) string {
+	widths := make([]int, len(columnNames))
+	for i, name := range columnNames {
+		widths[i] = utf8.RuneCountInString(name)
+	}
+	cells := make([][]string, len(rows))
+	for r, row := range rows {
+		cells[r] = make([]string, len(row))
+		for i, value := range row {
+			if !value.IsNull() {
+				cells[r][i] = value.String()
+			}
+			for i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if width := utf8.RuneCountInString(cells[r][i]); width > widths[i] {
+				widths[i] = width
+			}
+		}
+	}
+	pad := func(values []string) string {
+		padded := make([]string, len(values))
+		for i, value := range values {
+			padded[i] = value + strings.Repeat(" ", widths[i]-utf8.RuneCountInString(value))
+		}
+		return strings.Join(padded, "  ")
+	}
+
+	var lines []string
+	if header {
+		dashes := make([]string, len(columnNames))
+		for i := range columnNames {
+			dashes[i] = strings.Repeat("-", widths[i])
+		}
+		lines = append(lines, pad(columnNames), pad(dashes))
+	}
+	for _, row := range cells {
+		lines = append(lines, pad(row))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatJSON renders rows as a JSON array of objects keyed by column name, one object per line like sqlite3 -json.
+// An empty result prints nothing rather than [].
+func formatJSON(columnNames []string, rows Rows) string {
+	var objects []string
+	for _, row := range rows {
+		fields := make([]string, len(row))
+		for i, value := range row {
+			name := ""
+			if i < len(columnNames) {
+				name = columnNames[i]
+			}
+			fields[i] = jsonString(name) + ":" + jsonValue(value)
+		}
+		objects = append(objects, "{"+strings.Join(fields, ",")+"}")
+	}
+	if len(objects) == 0 {
+		return ""
+	}
+	return "[" + strings.Join(objects, ",\n") + "]"
+}
+
+// jsonValue keeps numbers as JSON numbers, blobs are written as their hex string
+func jsonValue(value Value) string {
+	switch data := value.Data.(type) {
+	case nil:
+		return "null"
+	case int64:
+		return strconv.FormatInt(data, 10)
+	case float64:
+		return value.SQLLiteral()
+	case bool:
+		return strconv.FormatBool(data)
+	}
+	return jsonString(value.String())
+}
+
+func jsonString(s string) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false) // Keep <, > and & readable, the output isn't embedded in HTML
+	encoder.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
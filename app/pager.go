@@ -0,0 +1,85 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+)
+
+// cacheSizeBytes bounds the page data the pager keeps in memory. sqlite's default cache_size of -2000 is negative so
+// it counts KiB rather than pages, 2000 KiB whatever the page size.
+const cacheSizeBytes = 2000 * 1024
+
+// Pager reads whole pages once and serves later reads of that page from memory. At most maxPages pages, as many as fit
+// in cacheSizeBytes, are kept, when the cache is full the least recently read page is dropped to make room.
+type Pager struct {
+	file     *os.File
+	pageSize int32
+	maxPages int
+	pages    map[int64]*list.Element // keyed by page number, the elements hold a cachedPage
+	lru      *list.List              // most recently read page at the front
+}
+
+// cachedPage is an entry of the pager's LRU list
+type cachedPage struct {
+	pageNumber int64
+	data       []byte
+}
+
+func newPager(file *os.File, pageSize int32) *Pager {
+	return &Pager{file: file, pageSize: pageSize, maxPages: max(cacheSizeBytes/int(pageSize), 1), pages: make(map[int64]*list.Element), lru: list.New()}
+}
+
+// readPage returns the bytes of a page. The slice is shared with the cache and with every other caller reading the
+// same page, so it must not be modified.
+func (p *Pager) readPage(pageNumber int64) ([]byte, error) {
+	if element, ok := p.pages[pageNumber]; ok {
+		p.lru.MoveToFront(element)
+		return element.Value.(*cachedPage).data, nil
+	}
+
+	page := make([]byte, p.pageSize)
+	n, err := p.file.ReadAt(page, (pageNumber-1)*int64(p.pageSize))
+	if n != len(page) {
+		return nil, fmt.Errorf("error reading page %d: %v", pageNumber, err)
+	}
+	if p.lru.Len() >= p.maxPages {
+		// An evicted page stays valid for callers still holding it, it's only no longer found in the cache
+		oldest := p.lru.Back()
+		p.lru.Remove(oldest)
+		delete(p.pages, oldest.Value.(*cachedPage).pageNumber)
+	}
+	p.pages[pageNumber] = p.lru.PushFront(&cachedPage{pageNumber: pageNumber, data: page})
+	return page, nil
+}
+
+// readAt returns numBytes starting at a file offset, the range may span several pages. A range inside one page is
+// returned as a slice of the cached page without copying, so callers must not modify the bytes. Its capacity ends with
+// the range so appending to it copies instead of overwriting the rest of the page.
+func (p *Pager) readAt(offset int64, numBytes int) ([]byte, error) {
+	if start := offset % int64(p.pageSize); start+int64(numBytes) <= int64(p.pageSize) {
+		page, err := p.readPage(offset/int64(p.pageSize) + 1)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %d bytes at offset %d: %v", numBytes, offset, err)
+		}
+		end := start + int64(numBytes)
+		return page[start:end:end], nil
+	}
+
+	buffer := make([]byte, 0, numBytes)
+	for len(buffer) < numBytes {
+		pageNumber := offset/int64(p.pageSize) + 1
+		page, err := p.readPage(pageNumber)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %d bytes at offset %d: %v", numBytes, offset, err)
+		}
+		start := offset % int64(p.pageSize)
+		end := start + int64(numBytes-len(buffer))
+		if end > int64(p.pageSize) {
+			end = int64(p.pageSize)
+		}
+		buffer = append(buffer, page[start:end]...)
+		offset += end - start
+	}
+	return buffer, nil
+}
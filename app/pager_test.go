@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writePagedFile writes pageCount pages of pageSize bytes where every byte of page n is n, and returns a pager over it
+func writePagedFile(t testing.TB, pageSize int32, pageCount int) *Pager {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "pages")
+	var data []byte
+	for n := 1; n <= pageCount; n++ {
+		data = append(data, bytes.Repeat([]byte{byte(n)}, int(pageSize))...)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	return newPager(file, pageSize)
+}
+
+func TestPagerEvictsLeastRecentlyReadPage(t *testing.T) {
+	pager := writePagedFile(t, 512, 4)
+	pager.maxPages = 2
+
+	for _, pageNumber := range []int64{1, 2, 1, 3} {
+		page, err := pager.readPage(pageNumber)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page[0] != byte(pageNumber) {
+			t.Fatalf("page %d starts with %d", pageNumber, page[0])
+		}
+	}
+	if len(pager.pages) != 2 || pager.lru.Len() != 2 {
+		t.Fatalf("cache holds %d pages and %d list entries, want 2", len(pager.pages), pager.lru.Len())
+	}
+	// Page 2 was read least recently when page 3 was added
+	if _, ok := pager.pages[2]; ok {
+		t.Error("page 2 is still cached")
+	}
+	for _, pageNumber := range []int64{1, 3} {
+		if _, ok := pager.pages[pageNumber]; !ok {
+			t.Errorf("page %d isn't cached", pageNumber)
+		}
+	}
+}
+
+func TestPagerReadAtSpansPages(t *testing.T) {
+	pager := writePagedFile(t, 512, 3)
+	pager.maxPages = 1
+
+	data, err := pager.readAt(500, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(append(bytes.Repeat([]byte{1}, 12), bytes.Repeat([]byte{2}, 512)...), bytes.Repeat([]byte{3}, 76)...)
+	if !bytes.Equal(data, want) {
+		t.Errorf("readAt(500, 600) = %v, want %v", data, want)
+	}
+	if _, err := pager.readAt(3*512-1, 2); err == nil {
+		t.Error("reading past the end of the file succeeded")
+	}
+}
+
+func BenchmarkPagerReadAtCached(b *testing.B) {
+	pager := writePagedFile(b, 4096, 64)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Every page is cached after the first round
+		if _, err := pager.readAt(int64(i%64)*4096+100, 200); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPagerReadAtUncached(b *testing.B) {
+	pager := writePagedFile(b, 4096, 64)
+	pager.maxPages = 1
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// With room for one page, alternating between two pages reads the file every time
+		if _, err := pager.readAt(int64(i%2)*4096+100, 200); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPagerReadAtAcrossPages(b *testing.B) {
+	pager := writePagedFile(b, 4096, 64)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := pager.readAt(int64(i%63)*4096+4000, 200); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestPagerCacheIsBoundedByBytes(t *testing.T) {
+	// Like sqlite's default cache_size of -2000, the cache holds 2000 KiB of pages whatever their size
+	for _, tt := range []struct {
+		pageSize int32
+		want     int
+	}{{512, 4000}, {1024, 2000}, {4096, 500}, {65536, 31}} {
+		if got := writePagedFile(t, tt.pageSize, 1).maxPages; got != tt.want {
+			t.Errorf("a pager of %d byte pages caches %d pages, want %d", tt.pageSize, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,632 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tokenizeSQL splits a statement on whitespace like strings.Fields, but keeps quoted literals and
+// identifiers together so that 'Granny Smith' or "full name" come back as a single token. The comparison
+// operators = == != <> < <= > >= are tokens of their own even when unspaced, so id>4 is id, > and 4.
+func tokenizeSQL(statement string) []string {
+	var tokens []string
+	var current strings.Builder
+	var quote byte
+	for i := 0; i < len(statement); i++ {
+		c := statement[i]
+		switch {
+		case quote != 0:
+			current.WriteByte(c)
+			if c == quote {
+				// A doubled quote inside a string literal is an escaped quote, not the end of it
+				if quote == '\'' && i+1 < len(statement) && statement[i+1] == '\'' {
+					current.WriteByte(c)
+					i++
+					continue
+				}
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			current.WriteByte(c)
+		case c == '[':
+			quote = ']'
+			current.WriteByte(c)
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		case c == '=' || c == '<' || c == '>' || c == '!' && i+1 < len(statement) && statement[i+1] == '=':
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+			operator := statement[i : i+1]
+			if i+1 < len(statement) && (statement[i+1] == '=' || c == '<' && statement[i+1] == '>') {
+				operator = statement[i : i+2]
+				i++
+			}
+			tokens = append(tokens, operator)
+		default:
+			current.WriteByte(c)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
+
+// stripSQLComments replaces -- line comments and /* block */ comments outside of quotes with a space, formatted
+// CREATE statements stored in sqlite_schema keep them
+func stripSQLComments(statement string) string {
+	var result strings.Builder
+	var quote byte
+	for i := 0; i < len(statement); i++ {
+		c := statement[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '[':
+			quote = ']'
+		case c == '-' && i+1 < len(statement) && statement[i+1] == '-':
+			for i < len(statement) && statement[i] != '\n' {
+				i++
+			}
+			result.WriteByte(' ')
+			if i < len(statement) {
+				result.WriteByte('\n')
+			}
+			continue
+		case c == '/' && i+1 < len(statement) && statement[i+1] == '*':
+			end := strings.Index(statement[i+2:], "*/")
+			if end == -1 {
+				i = len(statement) // An unterminated comment runs to the end
+			} else {
+				i += 2 + end + 1
+			}
+			result.WriteByte(' ')
+			continue
+		}
+		result.WriteByte(c)
+	}
+	return result.String()
+}
+
+// splitScript splits a script into the commands it contains. SQL statements end at a semicolon outside of quotes and
+// can span lines, a line starting with . between statements is a dot command on its own. A final statement without
+// a semicolon is kept.
+func splitScript(script string) []string {
+	var commands []string
+	var current strings.Builder
+	var quote byte
+	flush := func() {
+		if statement := strings.TrimSpace(current.String()); statement != "" {
+			commands = append(commands, statement)
+		}
+		current.Reset()
+	}
+	for _, line := range strings.Split(script, "\n") {
+		if quote == 0 && strings.TrimSpace(current.String()) == "" && strings.HasPrefix(strings.TrimSpace(line), ".") {
+			commands = append(commands, strings.TrimSpace(line))
+			current.Reset()
+			continue
+		}
+		for i := 0; i < len(line); i++ {
+			c := line[i]
+			switch {
+			case quote != 0:
+				if c == quote {
+					quote = 0 // A doubled quote closes and reopens, which leaves the literal intact
+				}
+			case c == '\'' || c == '"' || c == '`':
+				quote = c
+			case c == '[':
+				quote = ']'
+			case c == ';':
+				flush()
+				continue
+			}
+			current.WriteByte(c)
+		}
+		current.WriteByte('\n')
+	}
+	flush()
+	return commands
+}
+
+// literalText returns the text of a WHERE literal: the contents of a quoted string, the hex digits of a blob literal
+// x'..' with blob set, or the literal as written. A blob literal whose digits don't make whole bytes is an error.
+func literalText(literal string) (text string, blob bool, err error) {
+	if len(literal) >= 3 && strings.ToLower(literal[:2]) == "x'" && strings.HasSuffix(literal, "'") {
+		text = literal[2 : len(literal)-1]
+		if _, err := hex.DecodeString(text); err != nil {
+			return "", false, fmt.Errorf("unrecognized token: %q", literal)
+		}
+		return text, true, nil
+	}
+	return unquoteStringLiteral(literal), false, nil
+}
+
+// unquoteStringLiteral strips the single quotes around a string literal and unescapes doubled quotes inside it
+func unquoteStringLiteral(literal string) string {
+	if len(literal) >= 2 && literal[0] == '\'' && literal[len(literal)-1] == '\'' {
+		return strings.ReplaceAll(literal[1:len(literal)-1], "''", "'")
+	}
+	return literal
+}
+
+// parsePragma splits the words after PRAGMA into the pragma name and its argument, which can be
+// written as name(argument) or name = argument and is empty when there is none
+func parsePragma(words []string) (string, string) {
+	statement := strings.TrimSuffix(strings.Join(words, ""), ";")
+	if openParenIndex := strings.Index(statement, "("); openParenIndex != -1 && strings.HasSuffix(statement, ")") {
+		return statement[:openParenIndex], unquoteIdentifier(unquoteStringLiteral(statement[openParenIndex+1 : len(statement)-1]))
+	}
+	if name, argument, found := strings.Cut(statement, "="); found {
+		return name, unquoteIdentifier(unquoteStringLiteral(argument))
+	}
+	return statement, ""
+}
+
+// isColumnReference reports whether a WHERE value is written as a possibly qualified column name rather than a literal
+func isColumnReference(rawValue string) bool {
+	switch strings.ToLower(rawValue) {
+	case "", "null", "true", "false":
+		return false
+	}
+	for _, part := range strings.Split(rawValue, ".") {
+		if part == "" || (part[0] >= '0' && part[0] <= '9') {
+			return false
+		}
+		for _, c := range part {
+			if c != '_' && !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// parseTableList parses the tables of a FROM clause, separated by commas or [INNER|CROSS] JOIN. Each table can be
+// followed by [AS] alias and, when joined with JOIN, by ON and the conditions rows are joined on.
+func parseTableList(words []string) ([]TableRef, error) {
+	var tableRefs []TableRef
+	var err error
+	for _, part := range splitTopLevelCommas(strings.Join(words, " ")) {
+		var tokens []string
+		flush := func() {
+			if len(tokens) == 0 {
+				return
+			}
+			tableRef := TableRef{Name: unquoteIdentifier(tokens[0]), Alias: unquoteIdentifier(tokens[0])}
+			rest := tokens[1:]
+			for i, token := range rest {
+				if strings.ToLower(token) == "on" {
+					var onErr error
+					if tableRef.On, onErr = parseWhereConditions(rest[i+1:]); err == nil {
+						err = onErr
+					}
+					rest = rest[:i]
+					break
+				}
+			}
+			if len(rest) >= 2 && strings.ToLower(rest[0]) == "as" {
+				tableRef.Alias = unquoteIdentifier(rest[1])
+			} else if len(rest) >= 1 {
+				tableRef.Alias = unquoteIdentifier(rest[0])
+			}
+			tableRefs = append(tableRefs, tableRef)
+			tokens = nil
+		}
+		for _, token := range tokenizeSQL(part) {
+			switch strings.ToLower(token) {
+			case "join":
+				flush()
+			case "inner", "cross":
+				// Only the plain inner join exists here, the keyword before JOIN changes nothing
+			case "left", "right", "full", "outer", "natural":
+				// Not an alias, an outer or natural join would need rows an inner join doesn't produce
+				if err == nil {
+					err = fmt.Errorf("%s JOIN is not supported", strings.ToUpper(token))
+				}
+			default:
+				tokens = append(tokens, token)
+			}
+		}
+		flush()
+	}
+	return tableRefs, err
+}
+
+// stripTableQualifier removes the table. prefix from a column name in a single table query, the prefix has to be the
+// table's name or alias. splitQualifiedName is what joins use instead since they keep the qualifier.
+func stripTableQualifier(tableRef TableRef, name string) (string, bool) {
+	qualifier, column := splitQualifiedName(name)
+	if qualifier == "" {
+		return name, true
+	}
+	if !strings.EqualFold(qualifier, tableRef.Name) && !strings.EqualFold(qualifier, tableRef.Alias) {
+		return name, false
+	}
+	return column, true
+}
+
+// stripWhereQualifiers applies stripTableQualifier to every column named in the where clause and returns the first
+// column that belongs to another table
+func stripWhereQualifiers(tableRef TableRef, whereClause WhereClause) (string, bool) {
+	for _, group := range whereClause {
+		for i := range group {
+			column, ok := stripTableQualifier(tableRef, group[i].Column)
+			if !ok {
+				return group[i].Column, false
+			}
+			group[i].Column = column
+			if group[i].ValueColumn != "" {
+				// A value like other.x that isn't a column of this table is left to be compared as a literal
+				if valueColumn, ok := stripTableQualifier(tableRef, group[i].ValueColumn); ok {
+					group[i].ValueColumn = valueColumn
+				}
+			}
+		}
+	}
+	return "", true
+}
+
+// parseColumnList splits the words between SELECT and FROM on commas and strips any `AS alias`,
+// a column without an alias gets its own name as the alias
+func parseColumnList(words []string) ([]string, []string) {
+	var colNames []string
+	var aliases []string
+	// Commas inside quoted names like "a,b" don't separate columns, and however the words were spaced each part is
+	// tokenized again so a quoted name or alias stays one token
+	for _, part := range splitTopLevelCommas(strings.Join(words, " ")) {
+		fields := tokenizeSQL(part)
+		if len(fields) == 0 {
+			continue
+		}
+		alias := unquoteIdentifier(fields[0])
+		if len(fields) >= 3 && strings.ToLower(fields[1]) == "as" {
+			alias = unquoteIdentifier(fields[2])
+		}
+		colNames = append(colNames, unquoteIdentifier(fields[0]))
+		aliases = append(aliases, alias)
+	}
+	return colNames, aliases
+}
+
+// parseExpressionList is parseColumnList for a grouped query, each result column is kept as the expression text with
+// the whitespace between tokens removed so COUNT( * ) becomes COUNT(*). Without an alias the header is the expression
+// as it was written, like sqlite3 shows it.
+func parseExpressionList(words []string) ([]string, []string) {
+	var expressions []string
+	var headers []string
+	for _, part := range splitTopLevelCommas(strings.Join(words, " ")) {
+		fields := tokenizeSQL(part)
+		if len(fields) == 0 {
+			continue
+		}
+		header := strings.TrimSpace(part)
+		if n := len(fields); n >= 3 && strings.ToLower(fields[n-2]) == "as" {
+			header = unquoteIdentifier(fields[n-1])
+			fields = fields[:n-2]
+		}
+		expressions = append(expressions, strings.Join(fields, ""))
+		headers = append(headers, header)
+	}
+	return expressions, headers
+}
+
+// joinParenthesizedWords glues the words of a call like count( * ) back into one word so a HAVING condition has the
+// expression as its first word
+func joinParenthesizedWords(words []string) []string {
+	var joined []string
+	depth := 0
+	for _, word := range words {
+		if depth > 0 {
+			joined[len(joined)-1] += word
+		} else {
+			joined = append(joined, word)
+		}
+		depth += strings.Count(word, "(") - strings.Count(word, ")")
+	}
+	return joined
+}
+
+// parseAggregate splits an expression like AVG(price) into the lowercased function name and its column
+func parseAggregate(expression string) (string, string, bool) {
+	openParenIndex := strings.Index(expression, "(")
+	if openParenIndex == -1 || !strings.HasSuffix(expression, ")") {
+		return "", "", false
+	}
+	aggregate := strings.ToLower(expression[:openParenIndex])
+	argument := expression[openParenIndex+1 : len(expression)-1]
+	if strings.ContainsAny(argument, "(),") {
+		return "", "", false // Several calls like max(v),min(v) or an expression like max(v)*min(v)
+	}
+	switch aggregate {
+	case "sum", "avg", "min", "max":
+		return aggregate, unquoteIdentifier(argument), true
+	}
+	return "", "", false
+}
+
+// isAggregateExpression reports whether a result column is count(*) or an aggregate that parseAggregate understands
+func isAggregateExpression(expression string) bool {
+	_, _, ok := parseAggregate(expression)
+	return ok || strings.ToLower(expression) == "count(*)"
+}
+
+// parseLimitClause parses the words after LIMIT, written as LIMIT n, LIMIT n OFFSET m or LIMIT m, n with the offset
+// first. The offset is 0 when there is none and ok is false unless both are integers. Like in sqlite a negative limit
+// means no limit, which is -1, and a negative offset skips nothing.
+func parseLimitClause(words []string) (limit int, offset int, ok bool) {
+	parts := strings.Fields(strings.ReplaceAll(strings.Join(words, " "), ",", " , "))
+	limitText, offsetText := "", "0"
+	switch {
+	case len(parts) == 1:
+		limitText = parts[0]
+	case len(parts) == 3 && strings.ToLower(parts[1]) == "offset":
+		limitText, offsetText = parts[0], parts[2]
+	case len(parts) == 3 && parts[1] == ",":
+		offsetText, limitText = parts[0], parts[2]
+	default:
+		return 0, 0, false
+	}
+	limit, limitErr := strconv.Atoi(limitText)
+	offset, offsetErr := strconv.Atoi(offsetText)
+	if limitErr != nil || offsetErr != nil {
+		return 0, 0, false
+	}
+	return max(limit, -1), max(offset, 0), true
+}
+
+// parseWhereConditions splits the words following WHERE on the AND keyword and
+// turns each `column = value` group into a WhereCondition. NOT binds tighter than AND, it negates a single
+// condition whether written before it or as NOT IN, NOT LIKE and NOT BETWEEN. The AND of BETWEEN low AND high
+// belongs to the condition. A condition that is cut short, like id = or a dangling AND, is an incomplete input error
+// rather than being left out, which would match every row.
+func parseWhereConditions(words []string) ([]WhereCondition, error) {
+	var conditions []WhereCondition
+	var group []string
+	var err error
+	flush := func() {
+		defer func() { group = nil }()
+		if err != nil {
+			return
+		}
+		negate := false
+		for len(group) > 1 && strings.ToLower(group[0]) == "not" {
+			negate = !negate
+			group = group[1:]
+		}
+		if len(group) >= 3 && strings.ToLower(group[1]) == "not" {
+			if next := strings.ToLower(group[2]); next == "in" || next == "like" || next == "between" || strings.HasPrefix(next, "in(") {
+				negate = !negate
+				group = append([]string{group[0]}, group[2:]...)
+			}
+		}
+		conditionCount := len(conditions)
+		if len(group) < 2 || len(group) == 2 && strings.ToLower(group[1]) != "in" && !strings.HasPrefix(strings.ToLower(group[1]), "in(") {
+			if len(group) == 1 && strings.ToLower(group[0]) != "not" {
+				err = fmt.Errorf("unsupported condition: %s", group[0])
+			} else {
+				err = fmt.Errorf("incomplete input")
+			}
+			return
+		}
+
+		// column IS [NOT] NULL has no value to compare against
+		if strings.ToLower(group[1]) == "is" {
+			if last := strings.ToLower(group[len(group)-1]); last != "null" || len(group) > 4 || len(group) == 4 && strings.ToLower(group[2]) != "not" {
+				err = fmt.Errorf("near %q: syntax error", group[len(group)-1])
+				return
+			}
+			operator := "IS NULL"
+			if strings.ToLower(group[2]) == "not" {
+				operator = "IS NOT NULL"
+			}
+			conditions = append(conditions, WhereCondition{Column: unquoteIdentifier(group[0]), ColIdx: -1, Operator: operator})
+		} else if strings.ToLower(group[1]) == "in" || strings.HasPrefix(strings.ToLower(group[1]), "in(") {
+			// column IN (value, ...) with or without a space before the list
+			list := strings.TrimSpace(strings.Join(group[1:], " ")[2:])
+			if !strings.HasPrefix(list, "(") || !strings.HasSuffix(list, ")") {
+				err = fmt.Errorf("incomplete input")
+				return
+			}
+			list = strings.TrimSuffix(strings.TrimPrefix(list, "("), ")")
+			var values []string
+			var quotedValues, blobValues []bool
+			listHasNull := false
+			for _, item := range splitTopLevelCommas(list) {
+				if item = strings.TrimSpace(item); strings.ToLower(item) == "null" {
+					listHasNull = true // NULL never equals anything so it's left out
+				} else if item != "" {
+					text, blob, literalErr := literalText(item)
+					if literalErr != nil {
+						err = literalErr
+						return
+					}
+					values = append(values, text)
+					quotedValues = append(quotedValues, strings.HasSuffix(item, "'"))
+					blobValues = append(blobValues, blob)
+				}
+			}
+			conditions = append(conditions, WhereCondition{Column: unquoteIdentifier(group[0]), ColIdx: -1, Operator: "IN", Values: values, QuotedValues: quotedValues, BlobValues: blobValues, ListHasNull: listHasNull})
+		} else if strings.ToLower(group[1]) == "between" {
+			// column BETWEEN low AND high, both bounds are inclusive
+			andIndex := 3
+			for andIndex < len(group)-1 && strings.ToLower(group[andIndex]) != "and" {
+				andIndex++
+			}
+			if len(group) < 5 || strings.ToLower(group[andIndex]) != "and" {
+				err = fmt.Errorf("incomplete input")
+				return
+			}
+			var values []string
+			var quotedValues, blobValues []bool
+			for _, bound := range []string{strings.Join(group[2:andIndex], " "), strings.Join(group[andIndex+1:], " ")} {
+				text, blob, literalErr := literalText(bound)
+				if literalErr != nil {
+					err = literalErr
+					return
+				}
+				values = append(values, text)
+				quotedValues = append(quotedValues, strings.HasSuffix(bound, "'"))
+				blobValues = append(blobValues, blob)
+			}
+			conditions = append(conditions, WhereCondition{Column: unquoteIdentifier(group[0]), ColIdx: -1, Operator: "BETWEEN", Values: values, QuotedValues: quotedValues, BlobValues: blobValues})
+		} else {
+			operator := group[1]
+			switch strings.ToUpper(operator) {
+			case "==":
+				operator = "="
+			case "<>":
+				operator = "!="
+			case "LIKE":
+				operator = "LIKE"
+			case "=", "!=", "<", "<=", ">", ">=":
+			default:
+				err = fmt.Errorf("near %q: syntax error", operator)
+				return
+			}
+			valueWords := group[2:]
+			noCase := false
+			if n := len(valueWords); n >= 3 && strings.ToLower(valueWords[n-2]) == "collate" && strings.ToLower(valueWords[n-1]) == "nocase" {
+				valueWords = valueWords[:n-2]
+				noCase = true
+			}
+			escape := ""
+			if n := len(valueWords); operator == "LIKE" && n >= 3 && strings.ToLower(valueWords[n-2]) == "escape" {
+				escape = unquoteStringLiteral(valueWords[n-1])
+				valueWords = valueWords[:n-2]
+			}
+			if len(valueWords) > 1 {
+				err = fmt.Errorf("near %q: syntax error", valueWords[1])
+				return
+			}
+			rawValue := strings.Join(valueWords, " ")
+			value, blob, literalErr := literalText(rawValue)
+			if literalErr != nil {
+				err = literalErr
+				return
+			}
+			valueColumn := ""
+			if isColumnReference(rawValue) {
+				valueColumn = rawValue
+			}
+			quoted := strings.HasSuffix(rawValue, "'") // A string or blob literal, a bare number compares as a number
+			conditions = append(conditions, WhereCondition{Column: unquoteIdentifier(group[0]), ColIdx: -1, Operator: operator, Value: value, Quoted: quoted, Blob: blob, NoCase: noCase, Escape: escape, ValueColumn: valueColumn})
+		}
+		if negate && len(conditions) > conditionCount {
+			conditions[len(conditions)-1].Negate = true
+		}
+	}
+	betweenPending := false // the AND after BETWEEN low separates the bounds rather than two conditions
+	for _, word := range words {
+		switch strings.ToLower(word) {
+		case "between":
+			betweenPending = true
+		case "and":
+			if betweenPending {
+				betweenPending = false
+				group = append(group, word)
+				continue
+			}
+			flush()
+			continue
+		}
+		group = append(group, word)
+	}
+	flush()
+
+	return conditions, err
+}
+
+// parseWhereClause splits the words following WHERE on the OR keyword first so that AND groups bind tighter
+func parseWhereClause(words []string) (WhereClause, error) {
+	var clause WhereClause
+	var group []string
+	var err error
+	flush := func() {
+		if err == nil {
+			var conditions []WhereCondition
+			conditions, err = parseWhereConditions(group)
+			clause = append(clause, conditions)
+		}
+		group = nil
+	}
+	for _, word := range words {
+		if strings.ToLower(word) == "or" {
+			flush()
+			continue
+		}
+		group = append(group, word)
+	}
+	flush()
+
+	return clause, err
+}
+
+// unquoteIdentifier strips the "double", [bracket] or `backtick` quotes SQLite accepts around names
+func unquoteIdentifier(name string) string {
+	if len(name) < 2 {
+		return name
+	}
+	first, last := name[0], name[len(name)-1]
+	if first == '[' && last == ']' {
+		return name[1 : len(name)-1]
+	}
+	if (first == '"' && last == '"') || (first == '`' && last == '`') {
+		// The quote character is written twice to appear inside the name
+		return strings.ReplaceAll(name[1:len(name)-1], string([]byte{first, first}), string(first))
+	}
+	return name
+}
+
+// sqlKeywords are the words sqlite reserves, a name spelled like one has to be quoted
+var sqlKeywords = map[string]bool{
+	"ABORT": true, "ACTION": true, "ADD": true, "AFTER": true, "ALL": true, "ALTER": true, "ALWAYS": true,
+	"ANALYZE": true, "AND": true, "AS": true, "ASC": true, "ATTACH": true, "AUTOINCREMENT": true, "BEFORE": true,
+	"BEGIN": true, "BETWEEN": true, "BY": true, "CASCADE": true, "CASE": true, "CAST": true, "CHECK": true,
+	"COLLATE": true, "COLUMN": true, "COMMIT": true, "CONFLICT": true, "CONSTRAINT": true, "CREATE": true,
+	"CROSS": true, "CURRENT": true, "CURRENT_DATE": true, "CURRENT_TIME": true, "CURRENT_TIMESTAMP": true,
+	"DATABASE": true, "DEFAULT": true, "DEFERRABLE": true, "DEFERRED": true, "DELETE": true, "DESC": true,
+	"DETACH": true, "DISTINCT": true, "DO": true, "DROP": true, "EACH": true, "ELSE": true, "END": true, "ESCAPE": true,
+	"EXCEPT": true, "EXCLUDE": true, "EXCLUSIVE": true, "EXISTS": true, "EXPLAIN": true, "FAIL": true, "FILTER": true,
+	"FIRST": true, "FOLLOWING": true, "FOR": true, "FOREIGN": true, "FROM": true, "FULL": true, "GENERATED": true,
+	"GLOB": true, "GROUP": true, "GROUPS": true, "HAVING": true, "IF": true, "IGNORE": true, "IMMEDIATE": true,
+	"IN": true, "INDEX": true, "INDEXED": true, "INITIALLY": true, "INNER": true, "INSERT": true, "INSTEAD": true,
+	"INTERSECT": true, "INTO": true, "IS": true, "ISNULL": true, "JOIN": true, "KEY": true, "LAST": true, "LEFT": true,
+	"LIKE": true, "LIMIT": true, "MATCH": true, "MATERIALIZED": true, "NATURAL": true, "NO": true, "NOT": true,
+	"NOTHING": true, "NOTNULL": true, "NULL": true, "NULLS": true, "OF": true, "OFFSET": true, "ON": true, "OR": true,
+	"ORDER": true, "OTHERS": true, "OUTER": true, "OVER": true, "PARTITION": true, "PLAN": true, "PRAGMA": true,
+	"PRECEDING": true, "PRIMARY": true, "QUERY": true, "RAISE": true, "RANGE": true, "RECURSIVE": true,
+	"REFERENCES": true, "REGEXP": true, "REINDEX": true, "RELEASE": true, "RENAME": true, "REPLACE": true,
+	"RESTRICT": true, "RETURNING": true, "RIGHT": true, "ROLLBACK": true, "ROW": true, "ROWS": true, "SAVEPOINT": true,
+	"SELECT": true, "SET": true, "TABLE": true, "TEMP": true, "TEMPORARY": true, "THEN": true, "TIES": true, "TO": true,
+	"TRANSACTION": true, "TRIGGER": true, "UNBOUNDED": true, "UNION": true, "UNIQUE": true, "UPDATE": true,
+	"USING": true, "VACUUM": true, "VALUES": true, "VIEW": true, "VIRTUAL": true, "WHEN": true, "WHERE": true,
+	"WINDOW": true, "WITH": true, "WITHOUT": true,
+}
+
+// quoteIdentifierIfNeeded wraps a name in double quotes unless it is a plain identifier that isn't a keyword
+func quoteIdentifierIfNeeded(name string) string {
+	if sqlKeywords[strings.ToUpper(name)] {
+		return `"` + name + `"`
+	}
+	for i, c := range name {
+		if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9') {
+			continue
+		}
+		return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+	}
+	return name
+}
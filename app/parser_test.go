@@ -0,0 +1,112 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestUnquoteStringLiteral(t *testing.T) {
+	tests := []struct {
+		literal string
+		want    string
+	}{
+		{"'O''Brien'", "O'Brien"},
+		{"''''", "'"},
+		{"'it''s ''quoted'''", "it's 'quoted'"},
+		{"''", ""},
+		{"'plain'", "plain"},
+		{"42", "42"},
+	}
+	for _, tt := range tests {
+		if got := unquoteStringLiteral(tt.literal); got != tt.want {
+			t.Errorf("unquoteStringLiteral(%s) = %q, want %q", tt.literal, got, tt.want)
+		}
+	}
+}
+
+func TestTokenizeSQLKeepsEscapedQuotes(t *testing.T) {
+	got := tokenizeSQL("WHERE name = 'O''Brien' AND note != 'don''t split' OR x IN ('a''b', 'c')")
+	want := []string{"WHERE", "name", "=", "'O''Brien'", "AND", "note", "!=", "'don''t split'", "OR", "x", "IN", "('a''b',", "'c')"}
+	if !slices.Equal(got, want) {
+		t.Errorf("tokenizeSQL = %q, want %q", got, want)
+	}
+}
+
+func TestParseWhereClauseRejectsIncompleteConditions(t *testing.T) {
+	tests := []struct {
+		where string
+		want  string
+	}{
+		{"id =", "incomplete input"},
+		{"= 5", "incomplete input"},
+		{"id = 5 and", "incomplete input"},
+		{"id = 5 or", "incomplete input"},
+		{"id between 1", "incomplete input"},
+		{"id between 1 and", "incomplete input"},
+		{"id in", "incomplete input"},
+		{"id is", "incomplete input"},
+		{"id", "unsupported condition: id"},
+		{"id = 5 and name", "unsupported condition: name"},
+		{"id foo 5", `near "foo": syntax error`},
+		{"id = 5 extra", `near "extra": syntax error`},
+		{"name is not 'x'", `near "'x'": syntax error`},
+		{"b = x'ABC'", `unrecognized token: "x'ABC'"`},
+		{"b in (x'AB', x'0')", `unrecognized token: "x'0'"`},
+	}
+	for _, tt := range tests {
+		_, err := parseWhereClause(tokenizeSQL(tt.where))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("parseWhereClause(%q) error = %v, want %q", tt.where, err, tt.want)
+		}
+	}
+}
+
+func TestTokenizeSQLSplitsOperators(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want []string
+	}{
+		{"id>=5", []string{"id", ">=", "5"}},
+		{"id<>5 AND x<=-1", []string{"id", "<>", "5", "AND", "x", "<=", "-1"}},
+		{"a!=b", []string{"a", "!=", "b"}},
+		{"x>-5", []string{"x", ">", "-5"}},
+		{"x<y", []string{"x", "<", "y"}},
+		{"x=='a=b'", []string{"x", "==", "'a=b'"}},
+		{`"a=b"=1`, []string{`"a=b"`, "=", "1"}},
+	}
+	for _, tt := range tests {
+		if got := tokenizeSQL(tt.sql); !slices.Equal(got, tt.want) {
+			t.Errorf("tokenizeSQL(%q) = %q, want %q", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestParseWhereClauseWithoutSpacesAroundOperators(t *testing.T) {
+	tests := []struct {
+		where    string
+		operator string
+	}{
+		{"a=1", "="},
+		{"a =1", "="},
+		{"a= 1", "="},
+		{"a==1", "="},
+		{"a<>1", "!="},
+		{"a!=1", "!="},
+		{"a <>1", "!="},
+		{"a!= 1", "!="},
+	}
+	for _, tt := range tests {
+		whereClause, err := parseWhereClause(tokenizeSQL(tt.where))
+		if err != nil {
+			t.Errorf("parseWhereClause(%q) error = %v", tt.where, err)
+			continue
+		}
+		if len(whereClause) != 1 || len(whereClause[0]) != 1 {
+			t.Errorf("parseWhereClause(%q) = %+v, want a single condition", tt.where, whereClause)
+			continue
+		}
+		if got := whereClause[0][0]; got.Column != "a" || got.Operator != tt.operator || got.Value != "1" || got.Quoted {
+			t.Errorf("parseWhereClause(%q) = %+v, want a %s 1", tt.where, got, tt.operator)
+		}
+	}
+}
@@ -0,0 +1,836 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type WhereCondition struct {
+	Column   string // column name as written in the query
+	ColIdx   int    // resolved against the CREATE statement, -1 until resolved
+	Operator string // one of =, !=, <, >, <=, >=, LIKE, IN, BETWEEN, IS NULL, IS NOT NULL
+	Value    string
+	Quoted   bool     // Value was written as a string or blob literal, a bare number is compared as a number
+	Blob     bool     // Value was written as a blob literal x'..' and holds its hex digits
+	NoCase   bool     // COLLATE NOCASE, ASCII letters compare case-insensitively
+	Escape   string   // the ESCAPE character of a LIKE pattern, empty when there is none
+	Values   []string // the list of an IN condition, or the low and high bounds of BETWEEN
+	Negate   bool     // written with NOT, a NULL operand still matches neither way
+
+	QuotedValues []bool // Quoted for each of Values
+	BlobValues   []bool // Blob for each of Values
+
+	// Affinity is the type affinity of the column, set when the clause is resolved against the columns of a table and
+	// empty when the column's declared type isn't known. Literals are converted by it before comparing like in sqlite.
+	Affinity string
+
+	// ListHasNull is set when the IN list contains NULL, which is left out of Values. NOT IN never holds then.
+	ListHasNull bool
+
+	// ValueColumn is set when the right-hand side is an unquoted identifier like in a.id = b.aid. If it resolves to a
+	// column, ValueColIdx is its index and the row's value is compared, otherwise Value is used as a literal.
+	// ValueAffinity is that column's type affinity.
+	ValueColumn   string
+	ValueColIdx   int
+	ValueAffinity string
+}
+
+// TableRef is a table named in the FROM clause, Alias is what qualified column names refer to it by
+type TableRef struct {
+	Name  string
+	Alias string // the table name itself unless an alias is given
+
+	On []WhereCondition // the ON conditions of a JOIN, all of them have to hold
+}
+
+type OrderBy struct {
+	Column     string // empty when there is no ORDER BY
+	Descending bool
+}
+
+// WhereClause is an OR of AND groups, AND binds tighter than OR like in SQL
+type WhereClause [][]WhereCondition
+
+// parseColumnDefs returns the column definitions between the outer parentheses of a CREATE statement.
+// Commas nested in parentheses or quotes, like DECIMAL(10,2), do not split a definition and trailing
+// table constraints such as PRIMARY KEY (a, b) are dropped so indices line up with the record columns
+func parseColumnDefs(createStatement string) []string {
+	createStatement = stripSQLComments(createStatement)
+	openParenIndex := strings.Index(createStatement, "(")
+	closeParenIndex := strings.LastIndex(createStatement, ")")
+	columnsPart := createStatement[openParenIndex+1 : closeParenIndex]
+
+	columnDefs := splitTopLevelCommas(columnsPart)
+	for idx, colDef := range columnDefs {
+		if isTableConstraint(colDef) {
+			return columnDefs[:idx]
+		}
+	}
+	return columnDefs
+}
+
+// splitTopLevelCommas splits on the commas that are not nested in parentheses or quotes
+func splitTopLevelCommas(s string) []string {
+	var parts []string
+	depth := 0
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '[':
+			quote = ']'
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// evalConstantExpression evaluates a result column that does not refer to a table
+func (db *Database) evalConstantExpression(expression string) (Value, error) {
+	expression = strings.TrimSpace(expression)
+	if tokens := tokenizeSQL(expression); len(tokens) >= 3 && strings.ToLower(tokens[len(tokens)-2]) == "as" {
+		expression = strings.Join(tokens[:len(tokens)-2], " ") // The alias only matters for headers
+	}
+	if strings.ToLower(expression) == "sqlite_version()" {
+		return Value{SerialType: 13, Data: db.sqliteVersion()}, nil
+	}
+	parsed, err := parseExpression(expression)
+	if err != nil {
+		return Value{}, err
+	}
+	// Without a table there is nothing a column could refer to
+	if err := parsed.resolveColumns(func(colName string) (int, error) {
+		return -1, fmt.Errorf("no such column: %s", colName)
+	}); err != nil {
+		return Value{}, err
+	}
+	return parsed.evaluate(nil), nil
+}
+
+// isTableConstraint reports whether a definition starts with a keyword that can only open a table constraint
+func isTableConstraint(colDef string) bool {
+	words := strings.Fields(strings.ToUpper(colDef))
+	if len(words) == 0 {
+		return false
+	}
+	switch words[0] {
+	case "CONSTRAINT", "PRIMARY", "UNIQUE", "CHECK", "FOREIGN":
+		return true
+	}
+	return false
+}
+
+// columnDefName returns the unquoted column name a column definition starts with, or "" for an empty definition
+func columnDefName(colDef string) string {
+	words := tokenizeSQL(colDef) // A quoted name like "full name" is one token
+	if len(words) == 0 {
+		return ""
+	}
+	return unquoteIdentifier(words[0])
+}
+
+// columnDefaults returns the value of every column's DEFAULT clause, NULL when there is none or it isn't a constant
+func (db *Database) columnDefaults(columnDefs []string) []Value {
+	defaults := make([]Value, len(columnDefs))
+	for idx, colDef := range columnDefs {
+		tokens := tokenizeSQL(colDef)
+		for i := 0; i+1 < len(tokens); i++ {
+			if strings.ToLower(tokens[i]) == "default" {
+				if value, err := db.evalConstantExpression(tokens[i+1]); err == nil {
+					defaults[idx] = value
+				}
+				break
+			}
+		}
+	}
+	return defaults
+}
+
+// tableLayout is what decoding a table's rows needs besides the records themselves
+type tableLayout struct {
+	rowIdColIdx int     // the INTEGER PRIMARY KEY column holding the rowid, -1 when there is none
+	defaults    []Value // every column's DEFAULT, for rows stored before ALTER TABLE ADD COLUMN
+	realColumns []bool  // columns with REAL affinity
+	storedOrder []int   // WITHOUT ROWID tables only: the declared column of each value in the stored record
+}
+
+// newTableLayout works out the tableLayout of a table from its CREATE statement
+func (db *Database) newTableLayout(createStatement string) tableLayout {
+	columnDefs := parseColumnDefs(createStatement)
+	layout := tableLayout{
+		rowIdColIdx: findRowIdAliasColumn(createStatement),
+		defaults:    db.columnDefaults(columnDefs),
+		realColumns: columnHasRealAffinity(columnDefs),
+	}
+	if isWithoutRowId(createStatement) {
+		// The record holds the primary key columns in key order followed by the others in declared order
+		layout.rowIdColIdx = -1
+		columns := parseColumns(createStatement)
+		var keyColumns, otherColumns []int
+		for idx, column := range columns {
+			if column.PrimaryKey > 0 {
+				keyColumns = append(keyColumns, idx)
+			} else {
+				otherColumns = append(otherColumns, idx)
+			}
+		}
+		sort.SliceStable(keyColumns, func(i, j int) bool {
+			return columns[keyColumns[i]].PrimaryKey < columns[keyColumns[j]].PrimaryKey
+		})
+		layout.storedOrder = append(keyColumns, otherColumns...)
+	}
+	return layout
+}
+
+// isWithoutRowId reports whether a CREATE TABLE statement ends in WITHOUT ROWID, such a table is stored in an index
+// B-tree keyed by its primary key
+func isWithoutRowId(createStatement string) bool {
+	createStatement = stripSQLComments(createStatement)
+	closeParenIndex := strings.LastIndex(createStatement, ")")
+	if closeParenIndex == -1 {
+		return false
+	}
+	options := strings.Fields(strings.ToUpper(createStatement[closeParenIndex+1:]))
+	for i := 0; i+1 < len(options); i++ {
+		if strings.Trim(options[i], ",") == "WITHOUT" && strings.Trim(options[i+1], ",") == "ROWID" {
+			return true
+		}
+	}
+	return false
+}
+
+// findRowIdAliasColumn returns the index of the column that is an alias for the rowid, or -1. That is the column
+// declared with type INTEGER when it is the only primary key column, either inline or as a table constraint
+func findRowIdAliasColumn(createStatement string) int {
+	aliasIdx := -1
+	for idx, column := range parseColumns(createStatement) {
+		if column.PrimaryKey == 0 {
+			continue
+		}
+		if aliasIdx != -1 || column.PrimaryKey != 1 || strings.ToUpper(column.Type) != "INTEGER" {
+			return -1 // Composite or non-integer keys are stored next to a separate rowid
+		}
+		aliasIdx = idx
+	}
+	return aliasIdx
+}
+
+// resolveWhereClause copies the clause with every ColIdx and Affinity set, a condition on an unknown column stays at -1
+// and matches nothing
+func resolveWhereClause(columnDefs []string, whereClause WhereClause) WhereClause {
+	resolvedClause := resolveWhereClauseWith(whereClause, func(colName string) int {
+		return findColumnIndex(columnDefs, colName)
+	})
+	affinity := func(colIdx int) string {
+		if colIdx >= 0 && colIdx < len(columnDefs) {
+			return columnAffinity(columnDefs[colIdx])
+		} else if colIdx == len(columnDefs) {
+			return "INTEGER" // The rowid
+		}
+		return ""
+	}
+	for _, group := range resolvedClause {
+		for i := range group {
+			group[i].Affinity = affinity(group[i].ColIdx)
+			group[i].ValueAffinity = affinity(group[i].ValueColIdx)
+		}
+	}
+	return resolvedClause
+}
+
+// resolveWhereClauseWith is resolveWhereClause with the column lookup left to resolve, which returns -1 for unknown names
+func resolveWhereClauseWith(whereClause WhereClause, resolve func(colName string) int) WhereClause {
+	resolvedClause := make(WhereClause, len(whereClause))
+	for i, group := range whereClause {
+		resolvedClause[i] = make([]WhereCondition, len(group))
+		for j, condition := range group {
+			resolvedClause[i][j] = condition
+			resolvedClause[i][j].ColIdx = resolve(condition.Column)
+			resolvedClause[i][j].ValueColIdx = -1
+			if condition.ValueColumn != "" {
+				resolvedClause[i][j].ValueColIdx = resolve(condition.ValueColumn)
+			}
+		}
+	}
+	return resolvedClause
+}
+
+// resolveColumnIndices maps column names to their position in the CREATE statement, * expands to every column in declared order
+func resolveColumnIndices(columnDefs []string, colNames []string) []int {
+	var colIdxs []int
+	for _, colName := range colNames {
+		if colName == "*" {
+			for idx := range columnDefs {
+				colIdxs = append(colIdxs, idx)
+			}
+			continue
+		}
+		if idx := findColumnIndex(columnDefs, colName); idx != -1 {
+			colIdxs = append(colIdxs, idx)
+		}
+	}
+	return colIdxs
+}
+
+// findUnknownColumn returns the first of colNames that isn't * or a column of the table, resolveColumnIndices
+// would silently leave it out
+func findUnknownColumn(columnDefs []string, colNames []string) (string, bool) {
+	for _, colName := range colNames {
+		if colName != "*" && findColumnIndex(columnDefs, colName) == -1 {
+			return colName, true
+		}
+	}
+	return "", false
+}
+
+// findUnknownWhereColumn returns the first column named in the where clause that isn't a column of the table. An
+// unquoted identifier on the right-hand side like in name = Fuji is a column reference too, not a string.
+func findUnknownWhereColumn(columnDefs []string, whereClause WhereClause) (string, bool) {
+	for _, group := range whereClause {
+		for _, condition := range group {
+			if findColumnIndex(columnDefs, condition.Column) == -1 {
+				return condition.Column, true
+			}
+			if condition.ValueColumn != "" && findColumnIndex(columnDefs, condition.ValueColumn) == -1 {
+				return condition.ValueColumn, true
+			}
+		}
+	}
+	return "", false
+}
+
+// findColumnIndex returns the position of a column in the CREATE statement, or -1 when there is no such column.
+// rowid, _rowid_ and oid name the rowid unless a declared column uses that name, the rowid comes after the
+// declared columns in the values readRowValues returns
+func findColumnIndex(columnDefs []string, colName string) int {
+	for idx, colDef := range columnDefs {
+		if columnDefName(colDef) == colName {
+			return idx
+		}
+	}
+	switch strings.ToLower(colName) {
+	case "rowid", "_rowid_", "oid":
+		return len(columnDefs)
+	}
+	return -1
+}
+
+// storageClassRank orders the storage classes the way sqlite sorts them: NULL, then numbers, then text, then blobs
+func storageClassRank(value Value) int {
+	switch value.Data.(type) {
+	case nil:
+		return 0
+	case int64, float64:
+		return 1
+	case string:
+		return 2
+	}
+	return 3
+}
+
+// compareTypedValues compares two decoded values with sqlite's ordering: values of different storage classes order
+// by class, integers and reals compare numerically with each other, text compares bytewise and so do blobs
+func compareTypedValues(a Value, b Value) int {
+	aRank, bRank := storageClassRank(a), storageClassRank(b)
+	if aRank != bRank {
+		if aRank < bRank {
+			return -1
+		}
+		return 1
+	}
+
+	switch aData := a.Data.(type) {
+	case nil:
+		return 0
+	case int64:
+		if bData, ok := b.Data.(int64); ok {
+			return cmp.Compare(aData, bData)
+		}
+		return -compareIntegerWithReal(b.Data.(float64), aData)
+	case float64:
+		if bData, ok := b.Data.(int64); ok {
+			return compareIntegerWithReal(aData, bData)
+		}
+		return cmp.Compare(aData, b.Data.(float64))
+	case string:
+		return strings.Compare(aData, b.Data.(string))
+	case []byte:
+		return bytes.Compare(aData, b.Data.([]byte))
+	}
+	return 0
+}
+
+// compareIntegerWithReal compares a real with an integer. When they are equal as floats the real is converted
+// instead, so an integer beyond 2^53 doesn't compare equal to a real that merely rounds to it. Reals outside the int64
+// range are past every integer, float64(math.MaxInt64) itself rounds up to 2^63.
+func compareIntegerWithReal(real float64, integer int64) int {
+	switch {
+	case real >= math.MaxInt64:
+		return 1
+	case real < math.MinInt64:
+		return -1
+	}
+	if result := cmp.Compare(real, float64(integer)); result != 0 {
+		return result
+	}
+	return cmp.Compare(int64(real), integer)
+}
+
+// literalValue types a WHERE literal for comparing with a column value. A bare number is a number and a quoted literal
+// is text, then the column's affinity converts it like sqlite does: INTEGER, REAL and NUMERIC columns turn text that
+// reads as a number into one, TEXT columns turn numbers into text and BLOB columns leave the literal as it is. Without
+// an affinity the literal is typed like the value: a number when the value is one and the literal reads as one. A blob
+// literal holds hex digits and is a blob whatever the affinity.
+func literalValue(value Value, literal string, quoted bool, blob bool, affinity string) Value {
+	if blob {
+		if data, err := hex.DecodeString(literal); err == nil {
+			return Value{SerialType: int64(len(data))*2 + 12, Data: data}
+		}
+	}
+	if affinity != "" {
+		number, isNumber := parseNumber(literal)
+		switch {
+		case !isNumber:
+		case !quoted && affinity == "TEXT":
+			return Value{SerialType: 13, Data: number.String()} // 1e2 is compared as the text 100.0
+		case !quoted || affinity != "TEXT" && affinity != "BLOB":
+			return number
+		}
+		return Value{SerialType: 13, Data: literal}
+	}
+	if storageClassRank(value) == 1 {
+		if integer, err := strconv.ParseInt(literal, 10, 64); err == nil {
+			return Value{SerialType: 6, Data: integer}
+		}
+		if real, err := strconv.ParseFloat(literal, 64); err == nil {
+			return Value{SerialType: 7, Data: real}
+		}
+	}
+	return Value{SerialType: 13, Data: literal}
+}
+
+// parseNumber reads a literal that is entirely an integer or a real number
+func parseNumber(literal string) (Value, bool) {
+	if integer, err := strconv.ParseInt(literal, 10, 64); err == nil {
+		return Value{SerialType: 6, Data: integer}, true
+	}
+	if real, err := strconv.ParseFloat(literal, 64); err == nil {
+		return Value{SerialType: 7, Data: real}, true
+	}
+	return Value{}, false
+}
+
+// matchesWhereCondition compares one column value, a NULL only matches IS NULL and never a comparison
+func matchesWhereCondition(value Value, condition WhereCondition) bool {
+	if condition.Negate {
+		// NOT of an unknown result is still unknown, so comparing NULL doesn't match with NOT either
+		if value.IsNull() && condition.Operator != "IS NULL" && condition.Operator != "IS NOT NULL" {
+			return false
+		}
+		if condition.Operator == "IN" && condition.ListHasNull {
+			return false
+		}
+		condition.Negate = false
+		return !matchesWhereCondition(value, condition)
+	}
+	switch condition.Operator {
+	case "IS NULL":
+		return value.IsNull()
+	case "IS NOT NULL":
+		return !value.IsNull()
+	}
+	if value.IsNull() {
+		return false
+	}
+
+	if condition.Operator == "IN" {
+		for i, allowed := range condition.Values {
+			quoted := i < len(condition.QuotedValues) && condition.QuotedValues[i]
+			blob := i < len(condition.BlobValues) && condition.BlobValues[i]
+			if compareTypedValues(value, literalValue(value, allowed, quoted, blob, condition.Affinity)) == 0 {
+				return true
+			}
+		}
+		return false
+	}
+	if condition.Operator == "LIKE" {
+		return matchesLike(value.String(), condition.Value, condition.Escape)
+	}
+	if condition.Operator == "BETWEEN" {
+		if len(condition.Values) != 2 || len(condition.QuotedValues) != 2 {
+			return false
+		}
+		blobLow := len(condition.BlobValues) == 2 && condition.BlobValues[0]
+		blobHigh := len(condition.BlobValues) == 2 && condition.BlobValues[1]
+		low := literalValue(value, condition.Values[0], condition.QuotedValues[0], blobLow, condition.Affinity)
+		high := literalValue(value, condition.Values[1], condition.QuotedValues[1], blobHigh, condition.Affinity)
+		return compareTypedValues(value, low) >= 0 && compareTypedValues(value, high) <= 0
+	}
+
+	left, right := value, literalValue(value, condition.Value, condition.Quoted, condition.Blob, condition.Affinity)
+	if condition.NoCase {
+		left, right = foldCase(left, right)
+	}
+	return operatorMatches(compareTypedValues(left, right), condition.Operator)
+}
+
+// matchesColumnComparison compares a column value with the value of another column of the same row. A NULL on
+// either side matches neither way, with or without NOT.
+func matchesColumnComparison(value Value, other Value, condition WhereCondition) bool {
+	if value.IsNull() || other.IsNull() {
+		return false
+	}
+	var matches bool
+	if condition.Operator == "LIKE" {
+		matches = matchesLike(value.String(), other.String(), condition.Escape)
+	} else {
+		left, right := comparisonOperands(value, other, condition.Affinity, condition.ValueAffinity)
+		if condition.NoCase {
+			left, right = foldCase(left, right)
+		}
+		matches = operatorMatches(compareTypedValues(left, right), condition.Operator)
+	}
+	return matches != condition.Negate
+}
+
+// comparisonOperands converts two column values like sqlite does before comparing them. When only one of the columns
+// has INTEGER, REAL or NUMERIC affinity the other value gets NUMERIC affinity. Otherwise when one has TEXT affinity
+// and the other has none, which a column never has but an expression of HAVING does, the other gets TEXT affinity.
+func comparisonOperands(left Value, right Value, leftAffinity string, rightAffinity string) (Value, Value) {
+	isNumeric := func(affinity string) bool {
+		return affinity == "INTEGER" || affinity == "REAL" || affinity == "NUMERIC"
+	}
+	switch {
+	case isNumeric(leftAffinity) && !isNumeric(rightAffinity):
+		right = applyAffinity(right, "NUMERIC")
+	case isNumeric(rightAffinity) && !isNumeric(leftAffinity):
+		left = applyAffinity(left, "NUMERIC")
+	case leftAffinity == "TEXT" && rightAffinity == "":
+		right = applyAffinity(right, "TEXT")
+	case rightAffinity == "TEXT" && leftAffinity == "":
+		left = applyAffinity(left, "TEXT")
+	}
+	return left, right
+}
+
+// applyAffinity converts a value by a type affinity: INTEGER, REAL and NUMERIC turn text that reads as a number into
+// the number and TEXT turns a number into its text
+func applyAffinity(value Value, affinity string) Value {
+	switch affinity {
+	case "INTEGER", "REAL", "NUMERIC":
+		if text, ok := value.Data.(string); ok {
+			if number, isNumber := parseNumber(text); isNumber {
+				return number
+			}
+		}
+	case "TEXT":
+		if storageClassRank(value) == 1 {
+			return Value{SerialType: 13, Data: value.String()}
+		}
+	}
+	return value
+}
+
+// foldCase lowercases two text values for COLLATE NOCASE, anything else is compared as it is
+func foldCase(left Value, right Value) (Value, Value) {
+	if leftText, ok := left.Data.(string); ok {
+		if rightText, ok := right.Data.(string); ok {
+			left.Data, right.Data = strings.ToLower(leftText), strings.ToLower(rightText)
+		}
+	}
+	return left, right
+}
+
+// operatorMatches reports whether the result of comparing two values satisfies a comparison operator
+func operatorMatches(cmp int, operator string) bool {
+	switch operator {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case ">":
+		return cmp > 0
+	case "<=":
+		return cmp <= 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false // Unknown operator
+}
+
+// matchesLike implements LIKE: % matches any run of characters, _ exactly one, and ASCII letters match either case.
+// A character after escape is matched literally, so with ESCAPE '\' the pattern 100\% only matches "100%".
+func matchesLike(s string, pattern string, escape string) bool {
+	str, pat := []rune(s), []rune(pattern)
+	escapeRune := rune(-1)
+	if escape != "" {
+		escapeRune = []rune(escape)[0]
+	}
+	// Greedy matching that backtracks to the last % seen, like glob matching in most shells
+	si, pi := 0, 0
+	starPi, starSi := -1, 0
+	for si < len(str) {
+		if pi < len(pat) {
+			c := pat[pi]
+			switch {
+			case c == escapeRune && pi+1 < len(pat):
+				if likeFold(pat[pi+1]) == likeFold(str[si]) {
+					si, pi = si+1, pi+2
+					continue
+				}
+			case c == '%':
+				starPi, starSi = pi, si
+				pi++
+				continue
+			case c == '_' || likeFold(c) == likeFold(str[si]):
+				si, pi = si+1, pi+1
+				continue
+			}
+		}
+		if starPi == -1 {
+			return false
+		}
+		starSi++
+		si, pi = starSi, starPi+1
+	}
+	for pi < len(pat) && pat[pi] == '%' {
+		pi++
+	}
+	return pi == len(pat)
+}
+
+// likeFold lowercases ASCII letters only, LIKE is case sensitive for other characters like sqlite without ICU
+func likeFold(c rune) rune {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// matchesWhereConditions reports whether a row satisfies every condition, an empty slice matches everything
+func matchesWhereConditions(rowValues []Value, whereConditions []WhereCondition) bool {
+	for _, condition := range whereConditions {
+		if condition.ColIdx < 0 || condition.ColIdx >= len(rowValues) {
+			return false
+		}
+		if condition.ValueColumn != "" && condition.ValueColIdx >= 0 && condition.ValueColIdx < len(rowValues) {
+			if !matchesColumnComparison(rowValues[condition.ColIdx], rowValues[condition.ValueColIdx], condition) {
+				return false
+			}
+			continue
+		}
+		if !matchesWhereCondition(rowValues[condition.ColIdx], condition) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesWhereClause reports whether a row satisfies any AND group, each row is checked once so it can't be emitted twice
+func matchesWhereClause(rowValues []Value, whereClause WhereClause) bool {
+	if len(whereClause) == 0 {
+		return true
+	}
+	for _, group := range whereClause {
+		if matchesWhereConditions(rowValues, group) {
+			return true
+		}
+	}
+	return false
+}
+
+// rowIdRange is an inclusive range of rowids, a table scan skips the subtrees of rows outside it
+type rowIdRange struct {
+	low, high int64
+}
+
+// allRowIds is the range of a scan that reads every row
+var allRowIds = rowIdRange{low: math.MinInt64, high: math.MaxInt64}
+
+// whereRowIdRange returns a range that holds the rowid of every row matching the resolved where clause, narrowed by
+// the =, <, <=, >, >= and BETWEEN conditions on the rowid or its INTEGER PRIMARY KEY alias that compare with a number.
+// It only has to be wide enough, the rows in it are still checked against the clause. With OR it spans the ranges
+// of all the groups.
+func whereRowIdRange(whereClause WhereClause, layout tableLayout) rowIdRange {
+	if len(whereClause) == 0 || layout.storedOrder != nil {
+		return allRowIds
+	}
+	var spanned rowIdRange
+	for i, group := range whereClause {
+		groupRange := allRowIds
+		for _, condition := range group {
+			isRowId := condition.ColIdx == len(layout.defaults) || condition.ColIdx >= 0 && condition.ColIdx == layout.rowIdColIdx
+			if !isRowId || condition.Negate || condition.ValueColumn != "" {
+				continue
+			}
+			switch condition.Operator {
+			case "=", "<", "<=", ">", ">=":
+				groupRange = groupRange.narrow(condition.Operator, condition.Value)
+			case "BETWEEN":
+				if len(condition.Values) == 2 {
+					groupRange = groupRange.narrow(">=", condition.Values[0]).narrow("<=", condition.Values[1])
+				}
+			}
+		}
+		if i == 0 {
+			spanned = groupRange
+		} else {
+			spanned = rowIdRange{low: min(spanned.low, groupRange.low), high: max(spanned.high, groupRange.high)}
+		}
+	}
+	return spanned
+}
+
+// narrow returns the part of the range where rowid <operator> literal can hold. A literal that isn't a number leaves
+// the range as it is, a real one is rounded outwards so no integer that compares true falls outside.
+func (r rowIdRange) narrow(operator string, literal string) rowIdRange {
+	number, ok := parseNumber(literal)
+	if !ok {
+		return r
+	}
+	var low, high int64
+	switch bound := number.Data.(type) {
+	case int64:
+		low, high = bound, bound
+	case float64:
+		low, high = clampToInt64(math.Floor(bound)), clampToInt64(math.Ceil(bound))
+	}
+	switch operator {
+	case "=":
+		r.low, r.high = max(r.low, low), min(r.high, high)
+	case ">", ">=":
+		r.low = max(r.low, low)
+	case "<", "<=":
+		r.high = min(r.high, high)
+	}
+	return r
+}
+
+// contains reports whether rowId is in the range
+func (r rowIdRange) contains(rowId int64) bool {
+	return rowId >= r.low && rowId <= r.high
+}
+
+// clampToInt64 converts a whole float to the int64 closest to it
+func clampToInt64(f float64) int64 {
+	switch {
+	case f >= math.MaxInt64:
+		return math.MaxInt64
+	case f <= math.MinInt64:
+		return math.MinInt64
+	}
+	return int64(f)
+}
+
+// sortRows sorts rows on the column at keyIdx with compareTypedValues, so NULLs come first and numbers before text
+func sortRows(rows Rows, keyIdx int, descending bool) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i][keyIdx], rows[j][keyIdx]
+		if descending {
+			a, b = b, a
+		}
+		return compareTypedValues(a, b) < 0
+	})
+}
+
+// aggregateValues reduces the values of one column, NULLs are skipped and an empty input gives NULL
+func aggregateValues(aggregate string, values []Value) Value {
+	var nonNull []Value
+	for _, value := range values {
+		if !value.IsNull() {
+			nonNull = append(nonNull, value)
+		}
+	}
+	if len(nonNull) == 0 {
+		return Value{SerialType: 0, Data: nil}
+	}
+
+	switch aggregate {
+	case "min", "max":
+		result := nonNull[0]
+		for _, value := range nonNull[1:] {
+			cmp := compareTypedValues(value, result)
+			if (aggregate == "min" && cmp < 0) || (aggregate == "max" && cmp > 0) {
+				result = value
+			}
+		}
+		return result
+
+	case "sum", "avg":
+		var intSum int64 = 0
+		var floatSum float64 = 0
+		isInteger := true
+		for _, value := range nonNull {
+			switch data := value.Data.(type) {
+			case int64:
+				intSum += data
+				floatSum += float64(data)
+			case float64:
+				isInteger = false
+				floatSum += data
+			default:
+				isInteger = false
+				num, _ := strconv.ParseFloat(value.String(), 64) // Text that isn't a number counts as 0 like in sqlite
+				floatSum += num
+			}
+		}
+		if aggregate == "sum" && isInteger {
+			return Value{SerialType: 6, Data: intSum}
+		}
+		if aggregate == "avg" {
+			floatSum /= float64(len(nonNull))
+		}
+		return Value{SerialType: 7, Data: floatSum}
+	}
+
+	return Value{SerialType: 0, Data: nil}
+}
+
+// sortRowsByTrailingKey sorts rows that carry the ORDER BY key as an extra last column, then drops that column
+// and keeps at most limit rows
+func sortRowsByTrailingKey(rows Rows, descending bool, limit int, offset int) Rows {
+	var sortedRows Rows
+	if len(rows) == 0 {
+		return sortedRows
+	}
+	sortRows(rows, len(rows[0])-1, descending)
+	for _, row := range rows[min(offset, len(rows)):] {
+		if limit != -1 && len(sortedRows) >= limit {
+			break
+		}
+		sortedRows = append(sortedRows, row[:len(row)-1])
+	}
+	return sortedRows
+}
+
+// projectRow picks the values at colIdx out of the values of a whole row
+func projectRow(rowValues []Value, colIdx []int) []Value {
+	dataForCol := make([]Value, 0, len(colIdx))
+	for _, idx := range colIdx {
+		if idx >= 0 && idx < len(rowValues) { // An index past the last value, the rowid, is skipped
+			dataForCol = append(dataForCol, rowValues[idx])
+		}
+	}
+	return dataForCol
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestCompareTypedValues(t *testing.T) {
+	null := Value{SerialType: 0}
+	integer := func(i int64) Value { return Value{SerialType: 6, Data: i} }
+	real := func(f float64) Value { return Value{SerialType: 7, Data: f} }
+	text := func(s string) Value { return Value{SerialType: int64(len(s))*2 + 13, Data: s} }
+	blob := func(b ...byte) Value { return Value{SerialType: int64(len(b))*2 + 12, Data: b} }
+
+	tests := []struct {
+		name string
+		a, b Value
+		want int
+	}{
+		{"NULL equals NULL", null, null, 0},
+		{"NULL before integers", null, integer(math.MinInt64), -1},
+		{"NULL before reals", null, real(math.Inf(-1)), -1},
+		{"NULL before text", null, text(""), -1},
+		{"NULL before blobs", null, blob(), -1},
+		{"numbers before text", integer(math.MaxInt64), text("0"), -1},
+		{"reals before text", real(1e300), text(""), -1},
+		{"text before blobs", text("zzz"), blob(0x00), -1},
+		{"numbers before blobs", real(1), blob(), -1},
+		{"blobs after numbers", blob(0x01), integer(5), 1},
+		{"integers numerically", integer(2), integer(10), -1},
+		{"negative integers", integer(-10), integer(-2), -1},
+		{"integer equals real", integer(3), real(3.0), 0},
+		{"real between integers", real(2.5), integer(3), -1},
+		{"integer after smaller real", integer(3), real(2.5), 1},
+		{"largest integer before 2^63", integer(math.MaxInt64), real(9223372036854775807.0), -1},
+		{"smallest integer equals -2^63", integer(math.MinInt64), real(-9223372036854775808.0), 0},
+		{"integer beyond 2^53", integer(1<<53 + 1), real(1 << 53), 1},
+		{"text bytewise", text("B"), text("a"), -1},
+		{"text is not numeric", text("10"), text("9"), -1},
+		{"text prefix first", text("ab"), text("abc"), -1},
+		{"blobs bytewise", blob(0x01, 0xff), blob(0x02), -1},
+		{"equal blobs", blob(0x05), blob(0x05), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compareTypedValues(tt.a, tt.b); got != tt.want {
+				t.Errorf("compareTypedValues(%v, %v) = %d, want %d", tt.a.Data, tt.b.Data, got, tt.want)
+			}
+			if got := compareTypedValues(tt.b, tt.a); got != -tt.want {
+				t.Errorf("compareTypedValues(%v, %v) = %d, want %d", tt.b.Data, tt.a.Data, got, -tt.want)
+			}
+		})
+	}
+}
+
+func TestProjectRowLastColumn(t *testing.T) {
+	row := []Value{{SerialType: 13, Data: ""}, {SerialType: 15, Data: "a"}, {SerialType: 9, Data: int64(1)}}
+	tests := []struct {
+		colIdx []int
+		want   []Value
+	}{
+		{[]int{2}, row[2:3]},
+		{[]int{0, 2}, []Value{row[0], row[2]}},
+		{[]int{3}, []Value{}}, // One past the last value
+		{[]int{-1, 2, 3}, row[2:3]},
+	}
+	for _, tt := range tests {
+		if got := projectRow(row, tt.colIdx); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("projectRow(%v) = %v, want %v", tt.colIdx, got, tt.want)
+		}
+	}
+}
+
+func TestQueryLastColumn(t *testing.T) {
+	// The second row was written before ALTER TABLE added the last column, so its record is one value short
+	b := newTestDB(t, 4096)
+	b.addTable("t", "CREATE TABLE t(id integer primary key, a text, b text, c text DEFAULT 'none')",
+		testRow{1, []any{nil, "a1", "b1", "c1"}},
+		testRow{2, []any{nil, "a2", "b2"}})
+	db := b.open()
+
+	got := queryStrings(t, db, "t", []string{"c"}, nil)
+	if want := [][]string{{"c1"}, {"none"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SELECT c returned %v, want %v", got, want)
+	}
+	got = queryStrings(t, db, "t", []string{"*"}, mustParseWhere(t, "c = 'none'"))
+	if want := [][]string{{"2", "a2", "b2", "none"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SELECT * WHERE c = 'none' returned %v, want %v", got, want)
+	}
+	got = queryStrings(t, db, "t", []string{"c", "id"}, mustParseWhere(t, "id = 1"))
+	if want := [][]string{{"c1", "1"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SELECT c, id returned %v, want %v", got, want)
+	}
+}
+
+func TestMatchesLike(t *testing.T) {
+	// Expected results are what sqlite3 returns for s LIKE pattern [ESCAPE escape]
+	tests := []struct {
+		s, pattern, escape string
+		want               bool
+	}{
+		// Without % the pattern has to match the whole string
+		{"apple", "apple", "", true},
+		{"apple", "app", "", false},
+		{"pineapple", "apple", "", false},
+		{"apple", "app%", "", true},
+		{"apple", "%ple", "", true},
+		{"apple", "%pp%", "", true},
+		{"pineapple", "%apple", "", true},
+		{"apple", "a%e", "", true},
+		{"ae", "a%e", "", true},
+		{"a", "a%e", "", false},
+		{"", "%", "", true},
+		{"abcabd", "%ab_", "", true},
+		{"mississippi", "%iss%ppi", "", true},
+		// _ is exactly one character
+		{"apple", "a_ple", "", true},
+		{"aple", "a_ple", "", false},
+		{"apple", "_____", "", true},
+		{"apple", "____", "", false},
+		{"", "_", "", false},
+		// Only ASCII letters match either case
+		{"APPLE", "apple", "", true},
+		{"Apple", "a%E", "", true},
+		{"ÄPFEL", "äpfel", "", false},
+		{"äpfel", "äpfel", "", true},
+		// An escaped % or _ only matches itself
+		{"100%", `100\%`, `\`, true},
+		{"1000", `100\%`, `\`, false},
+		{"a_b", `a\_b`, `\`, true},
+		{"axb", `a\_b`, `\`, false},
+		{`a\b`, `a\\b`, `\`, true},
+		{"50%off", "%!%%", "!", true},
+		{"50off", "%!%%", "!", false},
+		{"Ab", "a!B", "!", true},
+	}
+	for _, tt := range tests {
+		if got := matchesLike(tt.s, tt.pattern, tt.escape); got != tt.want {
+			t.Errorf("matchesLike(%q, %q, %q) = %v, want %v", tt.s, tt.pattern, tt.escape, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Text encodings stored at offset 56 of the database header
+const (
+	encodingUTF8    uint32 = 1
+	encodingUTF16le uint32 = 2
+	encodingUTF16be uint32 = 3
+)
+
+// readVarint decodes a big-endian varint of 1 to 9 bytes. The 64 bits are accumulated unsigned and reinterpreted as
+// two's complement, so 9-byte varints give the full int64 range including negative rowids.
+func readVarint(data []byte, index int) (value int64, bytesRead int32) {
+	if index >= len(data) {
+		return 0, 0
+	}
+
+	maxBytes := 9
+	if index+maxBytes > len(data) {
+		maxBytes = len(data) - index
+	}
+
+	var bits uint64 = 0
+	bytesRead = 0
+
+	for i := 0; i < maxBytes && i < 9; i++ {
+		bytesRead++
+
+		// For the first 8 bytes, we only use the lower 7 bits
+		if i < 8 {
+			// Shift the existing value left by 7 bits and add the lower 7 bits of the current byte
+			bits = (bits << 7) | uint64(data[index+i]&0x7F)
+
+			// If the high bit is not set, we've reached the end of the varint
+			if (data[index+i] & 0x80) == 0 {
+				return int64(bits), bytesRead
+			}
+		} else {
+			// For the 9th byte, we use all 8 bits
+			bits = (bits << 8) | uint64(data[index+i])
+			return int64(bits), bytesRead
+		}
+	}
+
+	// If we've read 9 bytes or reached the end of the data, return what we have
+	return int64(bits), bytesRead
+}
+
+func getSerialTypeSize(serialType int64) int {
+	switch {
+	case serialType == 0, serialType == 8, serialType == 9:
+		return 0
+	case serialType == 1:
+		return 1
+	case serialType == 2:
+		return 2
+	case serialType == 3:
+		return 3
+	case serialType == 4:
+		return 4
+	case serialType == 5:
+		return 6
+	case serialType == 6, serialType == 7:
+		return 8
+	case serialType >= 12 && serialType%2 == 0: // BLOB
+		return int((serialType - 12) / 2)
+	case serialType >= 13 && serialType%2 == 1: // String
+		return int((serialType - 13) / 2)
+	}
+	return 0
+}
+
+// storageClassName names the storage class a serial type belongs to, the way typeof() reports it
+func storageClassName(serialType int64) string {
+	switch {
+	case serialType == 0:
+		return "null"
+	case serialType == 7:
+		return "real"
+	case serialType >= 12 && serialType%2 == 0:
+		return "blob"
+	case serialType >= 13:
+		return "text"
+	}
+	return "integer" // 1 to 6 and the constants 0 and 1 stored as 8 and 9
+}
+
+// decodeText converts TEXT bytes stored in the database encoding to a Go string
+func (db *Database) decodeText(value []byte) string {
+	if db.textEncoding != encodingUTF16le && db.textEncoding != encodingUTF16be {
+		return string(value)
+	}
+
+	units := make([]uint16, len(value)/2)
+	for i := range units {
+		if db.textEncoding == encodingUTF16le {
+			units[i] = binary.LittleEndian.Uint16(value[i*2:])
+		} else {
+			units[i] = binary.BigEndian.Uint16(value[i*2:])
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// Value is one decoded record value. Data holds nil for NULL, int64, float64, string for TEXT or []byte for BLOB,
+// so an integer 0 can be told apart from the text "0". Output of a -bool column can also hold a bool.
+type Value struct {
+	SerialType int64
+	Data       interface{}
+}
+
+// Rows is the result of a query, one []Value per row in the requested column order
+type Rows [][]Value
+
+func (v Value) IsNull() bool {
+	return v.Data == nil
+}
+
+// String formats the value the way the CLI prints it
+func (v Value) String() string {
+	switch data := v.Data.(type) {
+	case nil:
+		return "NULL"
+	case int64:
+		return strconv.FormatInt(data, 10)
+	case float64:
+		return formatFloat(data)
+	case []byte:
+		return strings.ToUpper(hex.EncodeToString(data)) // Same as sqlite's hex()
+	case string:
+		return data
+	case bool:
+		return strconv.FormatBool(data)
+	}
+	return fmt.Sprint(v.Data)
+}
+
+// formatFloat renders a REAL like sqlite3's %!.15g: 15 significant digits without trailing zeros, but always with a
+// decimal point so 3.0 and 1.0e+20 still read as floats
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case f == 0:
+		return "0.0" // Also for -0.0
+	}
+	s := strconv.FormatFloat(f, 'g', 15, 64)
+	mantissa, exponent, hasExponent := strings.Cut(s, "e")
+	if !strings.Contains(mantissa, ".") {
+		mantissa += ".0"
+	}
+	if hasExponent {
+		return mantissa + "e" + exponent
+	}
+	return mantissa
+}
+
+// SQLLiteral formats the value as a literal that can be pasted back into an INSERT statement, like .dump does
+func (v Value) SQLLiteral() string {
+	switch data := v.Data.(type) {
+	case nil:
+		return "NULL"
+	case float64:
+		literal := strconv.FormatFloat(data, 'g', -1, 64)
+		if !strings.ContainsAny(literal, ".eIN") { // Keep the value a REAL when it is read back in
+			literal += ".0"
+		}
+		return literal
+	case []byte:
+		return "X'" + strings.ToLower(hex.EncodeToString(data)) + "'"
+	case string:
+		return "'" + strings.ReplaceAll(data, "'", "''") + "'"
+	}
+	return v.String()
+}
+
+// readSignedBigEndian assembles a big-endian twos-complement integer of up to 8 bytes, the top bit of the first byte
+// is the sign and is extended into the bits above, so 24-bit 0x800000 is -8388608
+func readSignedBigEndian(value []byte) int64 {
+	var unsigned uint64
+	for _, b := range value {
+		unsigned = unsigned<<8 | uint64(b)
+	}
+	bits := uint(len(value)) * 8
+	if bits < 64 && unsigned&(1<<(bits-1)) != 0 {
+		unsigned |= ^uint64(0) << bits // Sign extension
+	}
+	return int64(unsigned)
+}
+
+// decodeValue turns the body bytes of one column into a typed Value
+func (db *Database) decodeValue(serialType int64, value []byte) Value {
+	var data interface{}
+
+	switch serialType {
+	case 0: // NULL
+		data = nil
+	case 1: // 8-bit twos-complement integer
+		data = int64(int8(value[0]))
+	case 2: // 16-bit twos-complement integer (big-endian)
+		data = int64(int16(binary.BigEndian.Uint16(value)))
+	case 3: // 24-bit twos-complement integer (big-endian)
+		data = readSignedBigEndian(value[:3])
+	case 4: // 32-bit twos-complement integer (big-endian)
+		data = int64(int32(binary.BigEndian.Uint32(value)))
+	case 5: // 48-bit twos-complement integer (big-endian)
+		data = readSignedBigEndian(value[:6])
+	case 6: // 64-bit twos-complement integer (big-endian)
+		data = int64(binary.BigEndian.Uint64(value))
+	case 7: // 64-bit IEEE 754-2008 floating point (big-endian)
+		bits := binary.BigEndian.Uint64(value)
+		data = math.Float64frombits(bits)
+	case 8: // Integer 0
+		data = int64(0)
+	case 9: // Integer 1
+		data = int64(1)
+	case 10, 11: // Reserved for internal use
+		data = fmt.Sprintf("Reserved(%d)", serialType)
+	default:
+		if serialType >= 12 && serialType%2 == 0 { // BLOB (N-12)/2 bytes
+			blobLen := (serialType - 12) / 2
+			if int64(len(value)) >= blobLen {
+				data = value[:blobLen]
+			} else {
+				data = "Invalid BLOB"
+			}
+		} else if serialType >= 13 && serialType%2 == 1 { // String (N-13)/2 bytes
+			strLen := (serialType - 13) / 2
+			if int64(len(value)) >= strLen {
+				data = db.decodeText(value[:strLen]) // No null terminator
+			} else {
+				data = "Invalid String"
+			}
+		} else {
+			data = "Unknown Type"
+		}
+	}
+
+	return Value{SerialType: serialType, Data: data}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestDecodeValue24And48BitIntegers(t *testing.T) {
+	db := &Database{textEncoding: encodingUTF8}
+	tests := []struct {
+		name       string
+		serialType int64
+		bytes      []byte
+		want       int64
+	}{
+		{"24-bit -1", 3, []byte{0xff, 0xff, 0xff}, -1},
+		{"24-bit minimum", 3, []byte{0x80, 0x00, 0x00}, -8388608},
+		{"24-bit maximum", 3, []byte{0x7f, 0xff, 0xff}, 8388607},
+		{"24-bit 0", 3, []byte{0x00, 0x00, 0x00}, 0},
+		{"48-bit -1", 5, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, -1},
+		{"48-bit minimum", 5, []byte{0x80, 0x00, 0x00, 0x00, 0x00, 0x00}, -140737488355328},
+		{"48-bit maximum", 5, []byte{0x7f, 0xff, 0xff, 0xff, 0xff, 0xff}, 140737488355327},
+		{"48-bit 0", 5, []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := db.decodeValue(tt.serialType, tt.bytes); got.Data != tt.want {
+				t.Errorf("decodeValue(%d, %x) = %#v, want %d", tt.serialType, tt.bytes, got.Data, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadVarintInt64Boundaries(t *testing.T) {
+	tests := []struct {
+		bytes []byte
+		want  int64
+	}{
+		{[]byte{0x00}, 0},
+		{[]byte{0x7f}, 127},
+		{[]byte{0x81, 0x00}, 128},
+		{[]byte{0xff, 0x7f}, 16383},
+		{[]byte{0xbf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, math.MaxInt64},
+		{[]byte{0xc0, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x00}, math.MinInt64},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, -1},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfb}, -5},
+	}
+	for _, tt := range tests {
+		// A byte after the varint must not be read, and the index has to be honoured
+		data := append(append([]byte{0x55}, tt.bytes...), 0x01)
+		got, bytesRead := readVarint(data, 1)
+		if got != tt.want || int(bytesRead) != len(tt.bytes) {
+			t.Errorf("readVarint(%x) = %d, %d bytes, want %d, %d bytes", tt.bytes, got, bytesRead, tt.want, len(tt.bytes))
+		}
+		if encoded := testVarint(tt.want); !bytes.Equal(encoded, tt.bytes) {
+			t.Errorf("testVarint(%d) = %x, want %x", tt.want, encoded, tt.bytes)
+		}
+	}
+}
+
+func TestDecodeValueIntegerSerialTypeBoundaries(t *testing.T) {
+	db := &Database{textEncoding: encodingUTF8}
+	tests := []struct {
+		serialType int64
+		bytes      []byte
+		want       int64
+	}{
+		{1, []byte{0x7f}, math.MaxInt8},
+		{1, []byte{0x80}, math.MinInt8},
+		{1, []byte{0xfb}, -5},
+		{2, []byte{0x7f, 0xff}, math.MaxInt16},
+		{2, []byte{0x80, 0x00}, math.MinInt16},
+		{2, []byte{0xff, 0xfb}, -5},
+		{3, []byte{0xff, 0xff, 0xfb}, -5},
+		{4, []byte{0x7f, 0xff, 0xff, 0xff}, math.MaxInt32},
+		{4, []byte{0x80, 0x00, 0x00, 0x00}, math.MinInt32},
+		{4, []byte{0xff, 0xff, 0xff, 0xfb}, -5},
+		{5, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xfb}, -5},
+		{6, []byte{0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, math.MaxInt64},
+		{6, []byte{0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, math.MinInt64},
+		{6, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfb}, -5},
+	}
+	for _, tt := range tests {
+		if size := getSerialTypeSize(tt.serialType); size != len(tt.bytes) {
+			t.Errorf("getSerialTypeSize(%d) = %d, want %d", tt.serialType, size, len(tt.bytes))
+		}
+		value := db.decodeValue(tt.serialType, tt.bytes)
+		if got, ok := value.Data.(int64); !ok || got != tt.want {
+			t.Errorf("decodeValue(%d, %x) = %v, want %d", tt.serialType, tt.bytes, value.Data, tt.want)
+		}
+	}
+}
+
+func TestReadSignedBigEndianSignBoundaries(t *testing.T) {
+	tests := []struct {
+		bytes []byte
+		want  int64
+	}{
+		{[]byte{0x7f, 0xff, 0xff}, 1<<23 - 1},
+		{[]byte{0x80, 0x00, 0x00}, -1 << 23},
+		{[]byte{0x80, 0x00, 0x01}, -1<<23 + 1},
+		{[]byte{0xff, 0xff, 0xfe}, -2},
+		{[]byte{0x00, 0x80, 0x00}, 1 << 15}, // Bit 15 set doesn't make a 24-bit value negative
+		{[]byte{0x7f, 0xff, 0xff, 0xff, 0xff, 0xff}, 1<<47 - 1},
+		{[]byte{0x80, 0x00, 0x00, 0x00, 0x00, 0x00}, -1 << 47},
+		{[]byte{0x80, 0x00, 0x00, 0x00, 0x00, 0x01}, -1<<47 + 1},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xfe}, -2},
+		{[]byte{0x00, 0x00, 0x80, 0x00, 0x00, 0x00}, 1 << 31}, // Neither does bit 31 of a 48-bit value
+		{[]byte{0x00, 0x00, 0x00, 0x80, 0x00, 0x00}, 1 << 23},
+	}
+	for _, tt := range tests {
+		if got := readSignedBigEndian(tt.bytes); got != tt.want {
+			t.Errorf("readSignedBigEndian(%x) = %d, want %d", tt.bytes, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeValueRoundTripsAroundSignBoundaries(t *testing.T) {
+	db := &Database{textEncoding: encodingUTF8}
+	for _, boundary := range []int64{1 << 23, 1 << 47} {
+		for _, v := range []int64{boundary - 2, boundary - 1, -boundary, -boundary + 1, -boundary - 1, boundary} {
+			serialType, body := testIntegerSerialType(v, nil)
+			value := db.decodeValue(serialType, body)
+			if got, ok := value.Data.(int64); !ok || got != v {
+				t.Errorf("%d stored as serial type %d (%x) decodes to %v", v, serialType, body, value.Data)
+			}
+		}
+	}
+}
+
+func TestFormatFloat(t *testing.T) {
+	// Expected strings are what sqlite3 prints for SELECT of the same value
+	tests := []struct {
+		f    float64
+		want string
+	}{
+		{1.0, "1.0"},
+		{3.0, "3.0"},
+		{100.0, "100.0"},
+		{-2.5, "-2.5"},
+		{0.1, "0.1"},
+		{123.456, "123.456"},
+		{0.0001, "0.0001"},
+		{1.0 / 3, "0.333333333333333"},
+		{2.0 / 3, "0.666666666666667"},
+		{1e-5, "1.0e-05"},
+		{1.5e-7, "1.5e-07"},
+		{-1e-300, "-1.0e-300"},
+		{1e15, "1.0e+15"},
+		{1e20, "1.0e+20"},
+		{1e308, "1.0e+308"},
+		{123456789012345.0, "123456789012345.0"},
+		// Integers past 15 digits can't be printed exactly and are rounded to 15 significant digits
+		{1234567890123456.0, "1.23456789012346e+15"},
+		{9007199254740993.0, "9.00719925474099e+15"},
+		{9223372036854775807.0, "9.22337203685478e+18"},
+		{math.Copysign(0, -1), "0.0"},
+		{math.Inf(1), "Inf"},
+		{math.Inf(-1), "-Inf"},
+	}
+	for _, tt := range tests {
+		if got := formatFloat(tt.f); got != tt.want {
+			t.Errorf("formatFloat(%v) = %q, want %q", tt.f, got, tt.want)
+		}
+	}
+}
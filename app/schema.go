@@ -0,0 +1,142 @@
+package main
+
+import (
+	"strings"
+)
+
+// Column is the metadata of one table column parsed from its CREATE TABLE statement, the same fields PRAGMA table_info reports
+type Column struct {
+	Name         string
+	Type         string // declared type as written, empty when the column has none
+	NotNull      bool
+	DefaultValue string // DEFAULT expression as written, empty when there is none
+	PrimaryKey   int    // 1-based position in the primary key, 0 when the column isn't part of it
+}
+
+// Keywords that end the declared type of a column and start its constraints
+var columnConstraintKeywords = map[string]bool{
+	"CONSTRAINT": true, "PRIMARY": true, "NOT": true, "NULL": true, "UNIQUE": true, "CHECK": true,
+	"DEFAULT": true, "COLLATE": true, "REFERENCES": true, "GENERATED": true, "AS": true,
+}
+
+// parseColumns returns the columns of a CREATE TABLE statement in declared order. Because sqlite rewrites the stored
+// statement on ALTER TABLE, columns added later are included as well.
+func parseColumns(createStatement string) []Column {
+	createStatement = stripSQLComments(createStatement)
+	openParenIndex := strings.Index(createStatement, "(")
+	closeParenIndex := strings.LastIndex(createStatement, ")")
+	if openParenIndex == -1 || closeParenIndex < openParenIndex {
+		return nil
+	}
+
+	var columns []Column
+	var primaryKeyNames []string
+	for _, colDef := range splitTopLevelCommas(createStatement[openParenIndex+1 : closeParenIndex]) {
+		if isTableConstraint(colDef) {
+			// A table constraint PRIMARY KEY (a, b) makes a and b the key columns in that order
+			words := strings.Fields(strings.ToUpper(colDef))
+			if words[0] == "CONSTRAINT" && len(words) > 2 {
+				words = words[2:]
+			}
+			if words[0] == "PRIMARY" {
+				keyOpenIndex := strings.Index(colDef, "(")
+				keyCloseIndex := strings.LastIndex(colDef, ")")
+				if keyOpenIndex != -1 && keyCloseIndex > keyOpenIndex {
+					for _, keyPart := range splitTopLevelCommas(colDef[keyOpenIndex+1 : keyCloseIndex]) {
+						primaryKeyNames = append(primaryKeyNames, columnDefName(keyPart))
+					}
+				}
+			}
+			continue
+		}
+
+		tokens := tokenizeSQL(colDef)
+		if len(tokens) == 0 {
+			continue
+		}
+		column := Column{Name: unquoteIdentifier(tokens[0])}
+		i := 1
+		var typeTokens []string
+		for ; i < len(tokens) && !columnConstraintKeywords[strings.ToUpper(tokens[i])]; i++ {
+			typeTokens = append(typeTokens, tokens[i])
+		}
+		column.Type = strings.Join(typeTokens, " ")
+
+		for ; i < len(tokens); i++ {
+			switch strings.ToUpper(tokens[i]) {
+			case "NOT":
+				if i+1 < len(tokens) && strings.ToUpper(tokens[i+1]) == "NULL" {
+					column.NotNull = true
+					i++
+				}
+			case "PRIMARY":
+				column.PrimaryKey = 1
+			case "DEFAULT":
+				column.DefaultValue, i = parseDefaultExpression(tokens, i+1)
+			}
+		}
+		columns = append(columns, column)
+	}
+
+	for position, name := range primaryKeyNames {
+		for idx := range columns {
+			if columns[idx].Name == name {
+				columns[idx].PrimaryKey = position + 1
+			}
+		}
+	}
+	return columns
+}
+
+// parseDefaultExpression returns the DEFAULT expression starting at tokens[start] and the index of its last token.
+// It is a single literal, a sign followed by a number, or a parenthesized expression that may span several tokens.
+func parseDefaultExpression(tokens []string, start int) (string, int) {
+	if start >= len(tokens) {
+		return "", start
+	}
+	if (tokens[start] == "-" || tokens[start] == "+") && start+1 < len(tokens) {
+		return tokens[start] + tokens[start+1], start + 1
+	}
+	if !strings.HasPrefix(tokens[start], "(") {
+		return tokens[start], start
+	}
+	depth := 0
+	for end := start; end < len(tokens); end++ {
+		depth += strings.Count(tokens[end], "(") - strings.Count(tokens[end], ")")
+		if depth <= 0 {
+			return strings.Join(tokens[start:end+1], " "), end
+		}
+	}
+	return strings.Join(tokens[start:], " "), len(tokens) - 1
+}
+
+// columnAffinity returns the type affinity sqlite derives from the declared type of a column definition, checking
+// in this order: INTEGER when it contains INT, TEXT for CHAR, CLOB or TEXT, BLOB for BLOB or no type at all, REAL
+// for REAL, FLOA or DOUB and NUMERIC for anything else
+func columnAffinity(colDef string) string {
+	tokens := tokenizeSQL(colDef)
+	var declaredType string
+	for i := 1; i < len(tokens) && !columnConstraintKeywords[strings.ToUpper(tokens[i])]; i++ {
+		declaredType += strings.ToUpper(tokens[i]) + " "
+	}
+	switch {
+	case strings.Contains(declaredType, "INT"):
+		return "INTEGER"
+	case strings.Contains(declaredType, "CHAR") || strings.Contains(declaredType, "CLOB") || strings.Contains(declaredType, "TEXT"):
+		return "TEXT"
+	case strings.Contains(declaredType, "BLOB") || declaredType == "":
+		return "BLOB"
+	case strings.Contains(declaredType, "REAL") || strings.Contains(declaredType, "FLOA") || strings.Contains(declaredType, "DOUB"):
+		return "REAL"
+	}
+	return "NUMERIC"
+}
+
+// columnHasRealAffinity marks the columns whose declared type gives them REAL affinity
+func columnHasRealAffinity(columnDefs []string) []bool {
+	realColumns := make([]bool, len(columnDefs))
+	for idx, colDef := range columnDefs {
+		realColumns[idx] = columnAffinity(colDef) == "REAL"
+	}
+	return realColumns
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseColumns(t *testing.T) {
+	tests := []struct {
+		name            string
+		createStatement string
+		want            []Column
+	}{
+		{
+			name:            "types and constraints",
+			createStatement: "CREATE TABLE t(id integer primary key autoincrement, name text not null, price real default 1.5, note)",
+			want: []Column{
+				{Name: "id", Type: "integer", PrimaryKey: 1},
+				{Name: "name", Type: "text", NotNull: true},
+				{Name: "price", Type: "real", DefaultValue: "1.5"},
+				{Name: "note"},
+			},
+		},
+		{
+			name:            "multi-word type, signed and parenthesized defaults",
+			createStatement: "CREATE TABLE t(a varchar(10) default 'x, y', b double precision default -1, c int default (1 + 2))",
+			want: []Column{
+				{Name: "a", Type: "varchar(10)", DefaultValue: "'x, y'"},
+				{Name: "b", Type: "double precision", DefaultValue: "-1"},
+				{Name: "c", Type: "int", DefaultValue: "(1 + 2)"},
+			},
+		},
+		{
+			name:            "table constraint primary key",
+			createStatement: "CREATE TABLE t(a text, b int, c, CONSTRAINT pk PRIMARY KEY (b, a), UNIQUE (c))",
+			want: []Column{
+				{Name: "a", Type: "text", PrimaryKey: 2},
+				{Name: "b", Type: "int", PrimaryKey: 1},
+				{Name: "c"},
+			},
+		},
+		{
+			name:            "quoted names and a column added by ALTER TABLE",
+			createStatement: "CREATE TABLE \"my table\"(\"first name\" text, [order] int, `group` blob, added text DEFAULT 'new')",
+			want: []Column{
+				{Name: "first name", Type: "text"},
+				{Name: "order", Type: "int"},
+				{Name: "group", Type: "blob"},
+				{Name: "added", Type: "text", DefaultValue: "'new'"},
+			},
+		},
+		{
+			name:            "not a create statement",
+			createStatement: "garbage",
+			want:            nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseColumns(tt.createStatement); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseColumns(%q) =\n%+v\nwant\n%+v", tt.createStatement, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestColumnsOfTable(t *testing.T) {
+	b := newTestDB(t, 4096)
+	b.addTable("apples", "CREATE TABLE apples(id integer primary key, name text not null, color text)")
+	db := b.open()
+
+	columns, err := db.Columns("apples")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Column{
+		{Name: "id", Type: "integer", PrimaryKey: 1},
+		{Name: "name", Type: "text", NotNull: true},
+		{Name: "color", Type: "text"},
+	}
+	if !reflect.DeepEqual(columns, want) {
+		t.Errorf("Columns(apples) = %+v, want %+v", columns, want)
+	}
+	if _, err := db.Columns("pears"); err == nil {
+		t.Error("Columns of a missing table succeeded")
+	}
+}
+
+func TestMultilineCreateStatement(t *testing.T) {
+	createStatement := "CREATE TABLE\n\tproducts (\n\t\tid integer primary key, -- the rowid\n\t\tname\ttext,\n\t\t/* price, in cents */\n\t\tprice integer\n\t)"
+	if got, want := parseColumnDefs(createStatement), []string{"id integer primary key", "name\ttext", "price integer"}; !reflect.DeepEqual(trimAll(got), want) {
+		t.Errorf("parseColumnDefs = %q, want %q", got, want)
+	}
+
+	b := newTestDB(t, 4096)
+	b.addTable("products", createStatement,
+		testRow{1, []any{nil, "pen", 150}}, testRow{2, []any{nil, "ink", 900}})
+	db := b.open()
+	got := queryStrings(t, db, "products", []string{"name", "price", "id"}, mustParseWhere(t, "price > 200"))
+	if want := [][]string{{"ink", "900", "2"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("price > 200 returned %v, want %v", got, want)
+	}
+}
+
+// trimAll trims the whitespace around every string, column definitions keep what surrounded them in the statement
+func trimAll(values []string) []string {
+	trimmed := make([]string, len(values))
+	for i, value := range values {
+		trimmed[i] = strings.TrimSpace(value)
+	}
+	return trimmed
+}
+
+func TestParseColumnDefsDropsTableConstraints(t *testing.T) {
+	tests := []struct {
+		createStatement string
+		want            []string
+	}{
+		{"CREATE TABLE t(a integer, b text, price DECIMAL(10,2), PRIMARY KEY (b, a))", []string{"a integer", "b text", "price DECIMAL(10,2)"}},
+		{"CREATE TABLE t(a, b, PRIMARY KEY(b,a), UNIQUE (a))", []string{"a", "b"}},
+		{"CREATE TABLE t(a, b, CONSTRAINT pk PRIMARY KEY (b, a))", []string{"a", "b"}},
+		{"CREATE TABLE t(a, b, FOREIGN KEY (a, b) REFERENCES u(x, y), CHECK (a > b))", []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		if got := parseColumnDefs(tt.createStatement); !reflect.DeepEqual(trimAll(got), tt.want) {
+			t.Errorf("parseColumnDefs(%q) = %q, want %q", tt.createStatement, got, tt.want)
+		}
+	}
+
+	// The constraint doesn't shift the columns, the last column still reads the last value of the record
+	b := newTestDB(t, 4096)
+	b.addTable("t", "CREATE TABLE t(a integer, b text, price DECIMAL(10,2), PRIMARY KEY (b, a))",
+		testRow{1, []any{7, "x", 1.5}}, testRow{2, []any{8, "y", 2.25}})
+	db := b.open()
+	got := queryStrings(t, db, "t", []string{"price", "b", "a"}, mustParseWhere(t, "a = 8"))
+	if want := [][]string{{"2.25", "y", "8"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("query = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testDB builds a database file for tests the way sqlite lays it out: page 1 holds the header and the root of
+// sqlite_schema, every table and index is a B-tree of leaf pages under as many interior levels as its cells need.
+// Pages that nothing is written to are left as holes in the file, so a root page far into the file stays cheap.
+type testDB struct {
+	t        testing.TB
+	pageSize int
+	pages    map[int][]byte
+	nextPage int
+	schema   [][]any // type, name, tbl_name, rootpage and sql of each schema row
+}
+
+// testRow is a row of a table B-tree
+type testRow struct {
+	rowId  int64
+	values []any
+}
+
+// testEntry is a cell of an interior page, the left child and the key bytes that follow it: the rowid varint of a
+// table B-tree or the payload size and record of an index B-tree
+type testEntry struct {
+	child int
+	key   []byte
+}
+
+func newTestDB(t testing.TB, pageSize int) *testDB {
+	t.Helper()
+	return &testDB{t: t, pageSize: pageSize, pages: make(map[int][]byte), nextPage: 2}
+}
+
+// testVarint encodes v as a sqlite varint, big-endian groups of 7 bits and a whole byte in the ninth position
+func testVarint(v int64) []byte {
+	u := uint64(v)
+	if u>>56 != 0 {
+		buf := make([]byte, 9)
+		buf[8] = byte(u)
+		u >>= 8
+		for i := 7; i >= 0; i-- {
+			buf[i] = byte(u&0x7f) | 0x80
+			u >>= 7
+		}
+		return buf
+	}
+	var groups []byte
+	for {
+		groups = append([]byte{byte(u & 0x7f)}, groups...)
+		u >>= 7
+		if u == 0 {
+			break
+		}
+	}
+	for i := 0; i < len(groups)-1; i++ {
+		groups[i] |= 0x80
+	}
+	return groups
+}
+
+// testRecord encodes values as a record, nil, int, int64, float64, string and []byte are stored like sqlite stores
+// them and integers get the smallest serial type that holds them
+func testRecord(values ...any) []byte {
+	var header, body []byte
+	for _, value := range values {
+		var serialType int64
+		switch v := value.(type) {
+		case nil:
+			serialType = 0
+		case int:
+			serialType, body = testIntegerSerialType(int64(v), body)
+		case int64:
+			serialType, body = testIntegerSerialType(v, body)
+		case float64:
+			serialType = 7
+			body = binary.BigEndian.AppendUint64(body, math.Float64bits(v))
+		case string:
+			serialType = int64(len(v))*2 + 13
+			body = append(body, v...)
+		case []byte:
+			serialType = int64(len(v))*2 + 12
+			body = append(body, v...)
+		default:
+			panic("testRecord: unsupported value type")
+		}
+		header = append(header, testVarint(serialType)...)
+	}
+	// The header size counts itself, one byte is enough for every record the tests build
+	return append(append([]byte{byte(len(header) + 1)}, header...), body...)
+}
+
+func testIntegerSerialType(v int64, body []byte) (int64, []byte) {
+	switch {
+	case v == 0:
+		return 8, body
+	case v == 1:
+		return 9, body
+	case v >= math.MinInt8 && v <= math.MaxInt8:
+		return 1, append(body, byte(v))
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		return 2, binary.BigEndian.AppendUint16(body, uint16(v))
+	case v >= -1<<23 && v < 1<<23:
+		return 3, append(body, byte(v>>16), byte(v>>8), byte(v))
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		return 4, binary.BigEndian.AppendUint32(body, uint32(v))
+	case v >= -1<<47 && v < 1<<47:
+		return 5, append(body, byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	return 6, binary.BigEndian.AppendUint64(body, uint64(v))
+}
+
+// allocPage returns the next page number that nothing has been written to or reserved
+func (b *testDB) allocPage() int {
+	for b.pages[b.nextPage] != nil {
+		b.nextPage++
+	}
+	b.pages[b.nextPage] = make([]byte, b.pageSize)
+	b.nextPage++
+	return b.nextPage - 1
+}
+
+// reservePage claims a page number chosen by the test, like a root page far into the file
+func (b *testDB) reservePage(pageNumber int) {
+	if b.pages[pageNumber] != nil {
+		b.t.Fatalf("page %d is already used", pageNumber)
+	}
+	b.pages[pageNumber] = make([]byte, b.pageSize)
+}
+
+// addTable writes rows, sorted by rowid, as a table B-tree and adds the table to the schema. It returns the root page.
+func (b *testDB) addTable(name string, sql string, rows ...testRow) int {
+	rootPage := b.allocPage()
+	b.writeTableTree(rootPage, rows)
+	b.schema = append(b.schema, []any{"table", name, name, rootPage, sql})
+	return rootPage
+}
+
+// addTableAt is addTable with the root at a page number chosen by the test
+func (b *testDB) addTableAt(rootPage int, name string, sql string, rows ...testRow) {
+	b.reservePage(rootPage)
+	b.writeTableTree(rootPage, rows)
+	b.schema = append(b.schema, []any{"table", name, name, rootPage, sql})
+}
+
+// addIndex writes keys as an index B-tree. Each key is the whole index record including the trailing rowid, or the
+// primary key and the other columns of a WITHOUT ROWID table, and the keys have to be in index order already.
+func (b *testDB) addIndex(schemaType string, name string, tableName string, sql string, keys ...[]any) int {
+	rootPage := b.allocPage()
+	var cells [][]byte
+	for _, key := range keys {
+		record := testRecord(key...)
+		if len(record) > (b.pageSize-12)*64/255-23 {
+			b.t.Fatalf("index record of %d bytes would overflow", len(record))
+		}
+		cells = append(cells, append(testVarint(int64(len(record))), record...))
+	}
+	b.writeIndexTree(rootPage, cells)
+	b.schema = append(b.schema, []any{schemaType, name, tableName, rootPage, sql})
+	return rootPage
+}
+
+func (b *testDB) writeTableTree(rootPage int, rows []testRow) {
+	var cells [][]byte
+	var rowIds []int64
+	for _, row := range rows {
+		record := testRecord(row.values...)
+		if len(record) > b.pageSize-35 {
+			b.t.Fatalf("record of rowid %d has %d bytes and would overflow", row.rowId, len(record))
+		}
+		cell := append(testVarint(int64(len(record))), testVarint(row.rowId)...)
+		cells = append(cells, append(cell, record...))
+		rowIds = append(rowIds, row.rowId)
+	}
+	if b.fits(rootPage, 8, cells) {
+		b.writePage(rootPage, pageTypeTableLeaf, cells, 0)
+		return
+	}
+
+	// Every leaf but the last is keyed by its largest rowid
+	var entries []testEntry
+	for start := 0; start < len(cells); {
+		end := b.fill(8, cells[start:]) + start
+		child := b.allocPage()
+		b.writePage(child, pageTypeTableLeaf, cells[start:end], 0)
+		entries = append(entries, testEntry{child: child, key: testVarint(rowIds[end-1])})
+		start = end
+	}
+	last := entries[len(entries)-1]
+	b.writeInterior(rootPage, pageTypeTableInterior, entries[:len(entries)-1], last.child)
+}
+
+func (b *testDB) writeIndexTree(rootPage int, cells [][]byte) {
+	if b.fits(rootPage, 8, cells) {
+		b.writePage(rootPage, pageTypeIndexLeaf, cells, 0)
+		return
+	}
+
+	// The cell after each leaf but the last moves up into the interior page to divide the leaves
+	var entries []testEntry
+	rightmost := 0
+	for start := 0; start < len(cells); {
+		end := b.fill(8, cells[start:]) + start
+		if end+1 == len(cells) {
+			end-- // Keep a cell for the last leaf after the divider
+		}
+		child := b.allocPage()
+		b.writePage(child, pageTypeIndexLeaf, cells[start:end], 0)
+		if end == len(cells) {
+			rightmost = child
+			break
+		}
+		entries = append(entries, testEntry{child: child, key: cells[end]})
+		start = end + 1
+	}
+	b.writeInterior(rootPage, pageTypeIndexInterior, entries, rightmost)
+}
+
+// writeInterior writes the entries into pageNumber, splitting them into another interior level when they don't fit.
+// The entry after each group moves up, its child becomes the group's rightmost pointer and its key divides the groups.
+func (b *testDB) writeInterior(pageNumber int, pageType byte, entries []testEntry, rightmost int) {
+	cells := func(entries []testEntry) [][]byte {
+		var cells [][]byte
+		for _, entry := range entries {
+			cells = append(cells, append(binary.BigEndian.AppendUint32(nil, uint32(entry.child)), entry.key...))
+		}
+		return cells
+	}
+	if b.fits(pageNumber, 12, cells(entries)) {
+		b.writePage(pageNumber, pageType, cells(entries), rightmost)
+		return
+	}
+	var parents []testEntry
+	for start := 0; ; {
+		end := b.fill(12, cells(entries[start:])) + start
+		if end+1 == len(entries) {
+			end--
+		}
+		child := b.allocPage()
+		if end == len(entries) {
+			b.writePage(child, pageType, cells(entries[start:end]), rightmost)
+			b.writeInterior(pageNumber, pageType, parents, child)
+			return
+		}
+		b.writePage(child, pageType, cells(entries[start:end]), entries[end].child)
+		parents = append(parents, testEntry{child: child, key: entries[end].key})
+		start = end + 1
+	}
+}
+
+// fill returns how many of cells fit on a page other than page 1 with a page header of headerSize bytes
+func (b *testDB) fill(headerSize int, cells [][]byte) int {
+	used := headerSize
+	for i, cell := range cells {
+		if used += len(cell) + 2; used > b.pageSize {
+			return i
+		}
+	}
+	return len(cells)
+}
+
+func (b *testDB) fits(pageNumber int, headerSize int, cells [][]byte) bool {
+	if pageNumber == 1 {
+		headerSize += 100
+	}
+	return b.fill(headerSize, cells) == len(cells)
+}
+
+// writePage lays out a B-tree page with the cell pointer array after the header and the cells packed at the end
+func (b *testDB) writePage(pageNumber int, pageType byte, cells [][]byte, rightmost int) {
+	page := b.pages[pageNumber]
+	if page == nil {
+		b.reservePage(pageNumber)
+		page = b.pages[pageNumber]
+	}
+	offset := 0
+	if pageNumber == 1 {
+		offset = 100
+	}
+	headerSize := 8
+	if pageType == pageTypeTableInterior || pageType == pageTypeIndexInterior {
+		headerSize = 12
+		binary.BigEndian.PutUint32(page[offset+8:], uint32(rightmost))
+	}
+	page[offset] = pageType
+	binary.BigEndian.PutUint16(page[offset+3:], uint16(len(cells)))
+	contentStart := b.pageSize
+	for i, cell := range cells {
+		contentStart -= len(cell)
+		copy(page[contentStart:], cell)
+		binary.BigEndian.PutUint16(page[offset+headerSize+2*i:], uint16(contentStart))
+	}
+	binary.BigEndian.PutUint16(page[offset+5:], uint16(contentStart)) // 65536 wraps to the 0 that stands for it
+}
+
+// path writes sqlite_schema into page 1 and the database header, then the file, and returns where it is
+func (b *testDB) path() string {
+	b.t.Helper()
+	var schemaRows []testRow
+	for i, row := range b.schema {
+		schemaRows = append(schemaRows, testRow{rowId: int64(i + 1), values: row})
+	}
+	b.pages[1] = make([]byte, b.pageSize)
+	b.writeTableTree(1, schemaRows)
+
+	pageCount := 0
+	for pageNumber := range b.pages {
+		pageCount = max(pageCount, pageNumber)
+	}
+	header := b.pages[1]
+	copy(header, "SQLite format 3\x00")
+	if b.pageSize == 65536 {
+		binary.BigEndian.PutUint16(header[16:], 1) // 65536 doesn't fit in 2 bytes, 1 stands for it
+	} else {
+		binary.BigEndian.PutUint16(header[16:], uint16(b.pageSize))
+	}
+	header[18], header[19] = 1, 1                   // Legacy file format versions
+	header[21], header[22], header[23] = 64, 32, 32 // Payload fractions
+	binary.BigEndian.PutUint32(header[24:], 1)      // File change counter
+	binary.BigEndian.PutUint32(header[28:], uint32(pageCount))
+	binary.BigEndian.PutUint32(header[40:], 1) // Schema cookie
+	binary.BigEndian.PutUint32(header[44:], 4) // Schema format
+	binary.BigEndian.PutUint32(header[56:], 1) // UTF-8
+	binary.BigEndian.PutUint32(header[92:], 1) // Version-valid-for, the page count is current
+	binary.BigEndian.PutUint32(header[96:], 3045000)
+
+	path := filepath.Join(b.t.TempDir(), "test.db")
+	file, err := os.Create(path)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	defer file.Close()
+	for pageNumber, page := range b.pages {
+		if _, err := file.WriteAt(page, int64(pageNumber-1)*int64(b.pageSize)); err != nil {
+			b.t.Fatal(err)
+		}
+	}
+	return path
+}
+
+// open writes the file and opens it, the database is closed when the test ends
+func (b *testDB) open() *Database {
+	b.t.Helper()
+	return openTestDB(b.t, b.path())
+}
+
+func openTestDB(t testing.TB, path string) *Database {
+	t.Helper()
+	db, err := OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// queryStrings runs Query and renders every value with Value.String
+func queryStrings(t testing.TB, db *Database, tableName string, colNames []string, whereClause WhereClause) [][]string {
+	t.Helper()
+	rows, err := db.Query(tableName, colNames, whereClause, OrderBy{}, -1, 0)
+	if err != nil {
+		t.Fatalf("query on %s: %v", tableName, err)
+	}
+	result := [][]string{}
+	for _, row := range rows {
+		var values []string
+		for _, value := range row {
+			values = append(values, value.String())
+		}
+		result = append(result, values)
+	}
+	return result
+}
+
+// mustParseWhere parses the words after WHERE of a statement written as one string
+func mustParseWhere(t testing.TB, where string) WhereClause {
+	t.Helper()
+	whereClause, err := parseWhereClause(tokenizeSQL(where))
+	if err != nil {
+		t.Fatalf("parsing %q: %v", where, err)
+	}
+	return whereClause
+}